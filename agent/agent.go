@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/constants"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/input"
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+func getRss(ctx context.Context) (rss uint64, err error) {
+	proc, err := process.NewProcessWithContext(ctx, int32(os.Getpid()))
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "agent: Failed to get process"),
+		}
+		return
+	}
+
+	mem, err := proc.MemoryInfoWithContext(ctx)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "agent: Failed to get process memory"),
+		}
+		return
+	}
+
+	rss = mem.RSS
+
+	return
+}
+
+func Handler(ctx context.Context, strm *stream.Stream) (err error) {
+	rss, err := getRss(ctx)
+	if err != nil {
+		return
+	}
+
+	memStats := &runtime.MemStats{}
+	runtime.ReadMemStats(memStats)
+
+	gcPauseLast := uint64(0)
+	if memStats.NumGC > 0 {
+		gcPauseLast = memStats.PauseNs[(memStats.NumGC+255)%256]
+	}
+
+	stats := strm.Stats()
+
+	doc := &Agent{
+		Version:       constants.Version,
+		Rss:           rss,
+		Goroutines:    runtime.NumGoroutine(),
+		GcCount:       memStats.NumGC,
+		GcPauseTotal:  memStats.PauseTotalNs,
+		GcPauseLast:   gcPauseLast,
+		Primary:       stats.Primary,
+		Secondary:     stats.Secondary,
+		Unacked:       stats.Unacked,
+		Spooled:       stats.Spooled,
+		Sent:          stats.Sent,
+		Dropped:       stats.Dropped,
+		Evicted:       stats.Evicted,
+		Retransmitted: stats.Retransmitted,
+		Reconnects:    stats.Reconnects,
+		Host:          stats.Host,
+		Inputs:        []*InputStatus{},
+	}
+
+	conf := stream.CurrentConf
+	if conf != nil {
+		doc.ConfVersion = conf.Version
+	}
+
+	for _, health := range input.GetHealth() {
+		doc.Inputs = append(doc.Inputs, &InputStatus{
+			Name:        health.Name,
+			State:       health.State,
+			LastSuccess: health.LastSuccess,
+		})
+	}
+
+	strm.Append(doc)
+
+	return
+}
+
+type Input struct {
+	input.Base
+}
+
+func (i *Input) Name() string {
+	return Type
+}
+
+func (i *Input) Rate() time.Duration {
+	return 60 * time.Second
+}
+
+func (i *Input) Collect(ctx context.Context) error {
+	return Handler(ctx, i.Stream)
+}
+
+func Register() {
+	stream.RegisterDoc(Type, func() stream.Doc {
+		return &Agent{}
+	})
+	input.Register(&Input{})
+}
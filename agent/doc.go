@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"time"
+)
+
+const (
+	Type = "agent"
+)
+
+type InputStatus struct {
+	Name        string    `json:"n"`
+	State       string    `json:"s"`
+	LastSuccess time.Time `json:"ls"`
+}
+
+type Agent struct {
+	Timestamp time.Time `json:"t"`
+
+	Version       string         `json:"ev"`
+	Rss           uint64         `json:"rs"`
+	Goroutines    int            `json:"gr"`
+	GcCount       uint32         `json:"gc"`
+	GcPauseTotal  uint64         `json:"gt"`
+	GcPauseLast   uint64         `json:"gl"`
+	Primary       int            `json:"bp"`
+	Secondary     int            `json:"bs"`
+	Unacked       int            `json:"bu"`
+	Spooled       int            `json:"bf"`
+	Sent          uint64         `json:"ds"`
+	Dropped       uint64         `json:"dd"`
+	Evicted       uint64         `json:"de"`
+	Retransmitted uint64         `json:"dr"`
+	Reconnects    uint64         `json:"rc"`
+	Host          string         `json:"h"`
+	ConfVersion   int64          `json:"cv"`
+	Inputs        []*InputStatus `json:"i"`
+}
+
+func (d *Agent) GetTimestamp() time.Time {
+	return d.Timestamp
+}
+
+func (d *Agent) SetTimestamp(timestamp time.Time) {
+	d.Timestamp = timestamp
+}
+
+func (d *Agent) GetType() string {
+	return Type
+}
@@ -0,0 +1,164 @@
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/pritunl/pritunl-endpoint/utils"
+)
+
+func verifyHttpHeaders(check *stream.Check, res *http.Response) (
+	shortErr, err error) {
+
+	for _, header := range check.ExpectedHeaders {
+		values := res.Header.Values(header.Key)
+		if len(values) == 0 {
+			shortErr = fmt.Errorf("http: missing header %s", header.Key)
+			err = &errortypes.VerificationError{
+				errors.Newf("check: Response missing header '%s'",
+					header.Key),
+			}
+			return
+		}
+
+		if header.Value == "" {
+			continue
+		}
+
+		found := false
+		for _, value := range values {
+			if strings.TrimSpace(value) == header.Value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			shortErr = fmt.Errorf("http: header %s mismatch", header.Key)
+			err = &errortypes.VerificationError{
+				errors.Newf("check: Response header '%s' mismatch",
+					header.Key),
+			}
+			return
+		}
+	}
+
+	return
+}
+
+func formatJsonValue(val interface{}) string {
+	switch v := val.(type) {
+	case string:
+		return v
+	case nil:
+		return "null"
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+func verifyHttpJson(check *stream.Check, body []byte) (
+	shortErr, err error) {
+
+	var data interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	err = decoder.Decode(&data)
+	if err != nil {
+		shortErr = fmt.Errorf("http: invalid json response")
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "check: Failed to parse json response"),
+		}
+		return
+	}
+
+	for _, assertion := range check.JsonAssertions {
+		val, ok := utils.LookupJsonPath(data, assertion.Segments())
+		if !ok {
+			shortErr = fmt.Errorf("http: json path %s not found",
+				assertion.Path)
+			err = &errortypes.VerificationError{
+				errors.Newf("check: Response json path '%s' not found",
+					assertion.Path),
+			}
+			return
+		}
+
+		value := formatJsonValue(val)
+		if value != assertion.Value {
+			shortErr = fmt.Errorf("http: json path %s is %s",
+				assertion.Path, utils.FilterStr(value, 128))
+			err = &errortypes.VerificationError{
+				errors.Newf("check: Response json path '%s' mismatch",
+					assertion.Path),
+			}
+			return
+		}
+	}
+
+	return
+}
+
+func verifyHttpBody(check *stream.Check, res *http.Response) (
+	shortErr, err error) {
+
+	body, err := io.ReadAll(io.LimitReader(
+		res.Body, check.MaxResponseSize+1))
+	if err != nil {
+		shortErr = err
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "check: Failed to read response body"),
+		}
+		return
+	}
+
+	if int64(len(body)) > check.MaxResponseSize {
+		shortErr = fmt.Errorf("http: response exceeds %d bytes",
+			check.MaxResponseSize)
+		err = &errortypes.VerificationError{
+			errors.New("check: Response body exceeds max size"),
+		}
+		return
+	}
+
+	if check.BodyContains != "" &&
+		!bytes.Contains(body, []byte(check.BodyContains)) {
+
+		shortErr = fmt.Errorf("http: body missing expected content")
+		err = &errortypes.VerificationError{
+			errors.New("check: Response body missing expected content"),
+		}
+		return
+	}
+
+	bodyRegex := check.BodyRegexp()
+	if bodyRegex != nil && !bodyRegex.Match(body) {
+		shortErr = fmt.Errorf("http: body does not match regex")
+		err = &errortypes.VerificationError{
+			errors.New("check: Response body does not match regex"),
+		}
+		return
+	}
+
+	if len(check.JsonAssertions) > 0 {
+		shortErr, err = verifyHttpJson(check, body)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
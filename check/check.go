@@ -1,9 +1,14 @@
 package check
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"runtime/debug"
+	"strings"
 	"time"
 
 	"github.com/dropbox/godropbox/errors"
@@ -14,7 +19,7 @@ import (
 )
 
 type checker struct {
-	stream *stream.Stream
+	input.Base
 }
 
 func (c *checker) runCheckHttp(check *stream.Check, target string) (
@@ -30,6 +35,7 @@ func (c *checker) runCheckHttp(check *stream.Check, target string) (
 	clientTransport := &http.Transport{
 		Proxy:                 http.ProxyFromEnvironment,
 		DialContext:           dailer.DialContext,
+		TLSClientConfig:       check.TlsConfig(),
 		ForceAttemptHTTP2:     true,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       90 * time.Second,
@@ -37,9 +43,32 @@ func (c *checker) runCheckHttp(check *stream.Check, target string) (
 		ExpectContinueTimeout: 1 * time.Second,
 	}
 
+	switch check.HttpVersion {
+	case "1.1":
+		clientTransport.Protocols = &http.Protocols{}
+		clientTransport.Protocols.SetHTTP1(true)
+	case "2":
+		clientTransport.Protocols = &http.Protocols{}
+		clientTransport.Protocols.SetHTTP2(true)
+		clientTransport.Protocols.SetUnencryptedHTTP2(true)
+	}
+	defer clientTransport.CloseIdleConnections()
+
 	client := &http.Client{
 		Transport: clientTransport,
 		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if check.NoRedirects {
+				return http.ErrUseLastResponse
+			}
+
+			if len(via) > check.MaxRedirects {
+				return fmt.Errorf("stopped after %d redirects",
+					check.MaxRedirects)
+			}
+
+			return nil
+		},
 	}
 
 	u, err := url.Parse(target)
@@ -51,10 +80,15 @@ func (c *checker) runCheckHttp(check *stream.Check, target string) (
 		return
 	}
 
+	var body io.Reader
+	if check.Body != "" {
+		body = strings.NewReader(check.Body)
+	}
+
 	req, err := http.NewRequest(
 		check.Method,
 		u.String(),
-		nil,
+		body,
 	)
 	if err != nil {
 		shortErr = err
@@ -83,10 +117,9 @@ func (c *checker) runCheckHttp(check *stream.Check, target string) (
 	defer res.Body.Close()
 
 	if res.StatusCode != check.StatusCode {
-		shortErr = err
+		shortErr = fmt.Errorf("http: unexpected status %d", res.StatusCode)
 		err = &errortypes.RequestError{
-			errors.Wrapf(
-				err,
+			errors.Newf(
 				"check: Request status error %d",
 				res.StatusCode,
 			),
@@ -94,62 +127,94 @@ func (c *checker) runCheckHttp(check *stream.Check, target string) (
 		return
 	}
 
+	shortErr, err = verifyHttpHeaders(check, res)
+	if err != nil {
+		return
+	}
+
+	shortErr, err = verifyHttpBody(check, res)
+	if err != nil {
+		return
+	}
+
 	return
 }
 
 func (c *checker) runCheck(check *stream.Check) (err error) {
-	switch check.Type {
-	case "http":
-		targets := []string{}
-		latencies := []int{}
-		errs := []string{}
-
-		if check.Targets != nil {
-			for _, target := range check.Targets {
-				latency, shortErr, checkErr := c.runCheckHttp(check, target)
-				checkErrStr := ""
-				if shortErr != nil {
-					latency = 0
-					checkErrStr = shortErr.Error()
-				}
-				if checkErr != nil {
-					logrus.WithFields(logrus.Fields{
-						"error": checkErr,
-					}).Error("check: Check run failed")
-				}
-
-				targets = append(targets, target)
-				latencies = append(latencies, latency)
-				errs = append(errs, checkErrStr)
-			}
+	targets := []string{}
+	latencies := []int{}
+	losses := []int{}
+	expiries := []int{}
+	errs := []string{}
+
+	for _, target := range check.Targets {
+		var latency, loss, expiry int
+		var shortErr, checkErr error
+
+		switch check.Type {
+		case "http":
+			latency, shortErr, checkErr = c.runCheckHttp(check, target)
+		case "ping":
+			latency, loss, shortErr, checkErr = c.runCheckPing(
+				check, target)
+		case "tcp":
+			latency, shortErr, checkErr = c.runCheckTcp(check, target)
+		case "tls":
+			latency, expiry, shortErr, checkErr = c.runCheckTls(
+				check, target)
+		case "dns":
+			latency, shortErr, checkErr = c.runCheckDns(check, target)
+		default:
+			logrus.WithFields(logrus.Fields{
+				"type": check.Type,
+			}).Warn("check: Ignoring unknown check type")
+			return
 		}
 
-		doc := &Check{
-			CheckId: check.Id,
-			Targets: targets,
-			Latency: latencies,
-			Errors:  errs,
+		checkErrStr := ""
+		if shortErr != nil {
+			latency = 0
+			checkErrStr = shortErr.Error()
+		}
+		if checkErr != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": checkErr,
+			}).Error("check: Check run failed")
 		}
 
-		c.stream.Append(doc)
+		targets = append(targets, target)
+		latencies = append(latencies, latency)
+		losses = append(losses, loss)
+		expiries = append(expiries, expiry)
+		errs = append(errs, checkErrStr)
+	}
 
-		break
+	doc := &Check{
+		CheckId: check.Id,
+		Targets: targets,
+		Latency: latencies,
+		Errors:  errs,
+	}
+
+	switch check.Type {
 	case "ping":
-		break
-	default:
-		logrus.WithFields(logrus.Fields{
-			"type": check.Type,
-		}).Warn("check: Ignoring unknown check type")
+		doc.Loss = losses
+	case "tls":
+		doc.Expiry = expiries
 	}
 
+	c.Stream.Append(doc)
+
 	return
 }
 
-func (c *checker) Run(strm *stream.Stream) {
-	c.stream = strm
-
+func (c *checker) Run(ctx context.Context) {
 	for {
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(1 * time.Second):
+		}
 
 		conf := stream.CurrentConf
 		if conf == nil || conf.Checks == nil || len(conf.Checks) == 0 {
@@ -169,6 +234,17 @@ func (c *checker) Run(strm *stream.Stream) {
 				check.SetNotReady()
 
 				go func(check *stream.Check) {
+					defer func() {
+						rec := recover()
+						if rec != nil {
+							logrus.WithFields(logrus.Fields{
+								"check_id": check.Id,
+								"panic":    fmt.Sprint(rec),
+								"stack":    string(debug.Stack()),
+							}).Error("check: Check panic recovered")
+						}
+					}()
+
 					err := c.runCheck(check)
 					if err != nil {
 						logrus.WithFields(logrus.Fields{
@@ -182,18 +258,22 @@ func (c *checker) Run(strm *stream.Stream) {
 	}
 }
 
-func startup(stream *stream.Stream) (err error) {
-	checkr := &checker{}
-	go checkr.Run(stream)
+func (c *checker) Name() string {
+	return Type
+}
+
+func (c *checker) Start(ctx context.Context, strm *stream.Stream) (
+	err error) {
+
+	c.Stream = strm
+	c.Run(ctx)
 
 	return
 }
 
 func Register() {
-	in := &input.Input{
-		Name:    Type,
-		Startup: startup,
-	}
-
-	input.Register(in)
+	stream.RegisterDoc(Type, func() stream.Doc {
+		return &Check{}
+	})
+	input.Register(&checker{})
 }
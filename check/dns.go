@@ -0,0 +1,303 @@
+package check
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/pritunl/pritunl-endpoint/utils"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var recordTypes = map[string]dnsmessage.Type{
+	"A":     dnsmessage.TypeA,
+	"AAAA":  dnsmessage.TypeAAAA,
+	"CNAME": dnsmessage.TypeCNAME,
+	"MX":    dnsmessage.TypeMX,
+	"TXT":   dnsmessage.TypeTXT,
+}
+
+func normalizeRecord(val string) string {
+	return strings.ToLower(strings.TrimSuffix(val, "."))
+}
+
+func exchange(ctx context.Context, network, server string,
+	query *dnsmessage.Message) (res *dnsmessage.Message, err error) {
+
+	data, err := query.Pack()
+	if err != nil {
+		return
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			return
+		}
+	}
+
+	if network == "tcp" {
+		length := make([]byte, 2)
+		binary.BigEndian.PutUint16(length, uint16(len(data)))
+
+		_, err = conn.Write(append(length, data...))
+		if err != nil {
+			return
+		}
+
+		_, err = io.ReadFull(conn, length)
+		if err != nil {
+			return
+		}
+
+		buffer := make([]byte, binary.BigEndian.Uint16(length))
+		_, err = io.ReadFull(conn, buffer)
+		if err != nil {
+			return
+		}
+
+		res = &dnsmessage.Message{}
+		err = res.Unpack(buffer)
+		if err != nil {
+			return
+		}
+
+		if res.ID != query.ID {
+			err = fmt.Errorf("dns: response id mismatch")
+		}
+		return
+	}
+
+	_, err = conn.Write(data)
+	if err != nil {
+		return
+	}
+
+	buffer := make([]byte, 65535)
+	for {
+		n, e := conn.Read(buffer)
+		if e != nil {
+			err = e
+			return
+		}
+
+		res = &dnsmessage.Message{}
+		e = res.Unpack(buffer[:n])
+		if e != nil || res.ID != query.ID {
+			continue
+		}
+
+		return
+	}
+}
+
+func queryRecords(ctx context.Context, server, recordType,
+	target string) (records []string, err error) {
+
+	fqdn := target
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+
+	name, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return
+	}
+
+	idBytes, err := utils.RandBytes(2)
+	if err != nil {
+		return
+	}
+
+	typ := recordTypes[recordType]
+	query := &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               binary.BigEndian.Uint16(idBytes),
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{
+			{
+				Name:  name,
+				Type:  typ,
+				Class: dnsmessage.ClassINET,
+			},
+		},
+	}
+
+	res, err := exchange(ctx, "udp", server, query)
+	if err != nil {
+		return
+	}
+
+	if res.Truncated {
+		res, err = exchange(ctx, "tcp", server, query)
+		if err != nil {
+			return
+		}
+	}
+
+	switch res.RCode {
+	case dnsmessage.RCodeSuccess:
+		break
+	case dnsmessage.RCodeNameError:
+		err = &net.DNSError{
+			Err:        "no such host",
+			Name:       target,
+			Server:     server,
+			IsNotFound: true,
+		}
+		return
+	default:
+		err = &net.DNSError{
+			Err:    fmt.Sprintf("server returned %s", res.RCode),
+			Name:   target,
+			Server: server,
+		}
+		return
+	}
+
+	for _, answer := range res.Answers {
+		if answer.Header.Type != typ {
+			continue
+		}
+
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			records = append(records, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			records = append(records, net.IP(body.AAAA[:]).String())
+		case *dnsmessage.CNAMEResource:
+			records = append(records, body.CNAME.String())
+		case *dnsmessage.MXResource:
+			records = append(records, body.MX.String())
+		case *dnsmessage.TXTResource:
+			records = append(records, strings.Join(body.TXT, ""))
+		}
+	}
+
+	return
+}
+
+func lookupRecords(ctx context.Context, recordType, target string) (
+	records []string, err error) {
+
+	resolver := net.DefaultResolver
+
+	switch recordType {
+	case "A", "AAAA":
+		network := "ip4"
+		if recordType == "AAAA" {
+			network = "ip6"
+		}
+
+		ips, e := resolver.LookupIP(ctx, network, target)
+		if e != nil {
+			err = e
+			return
+		}
+
+		for _, ip := range ips {
+			records = append(records, ip.String())
+		}
+	case "CNAME":
+		cname, e := resolver.LookupCNAME(ctx, target)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if normalizeRecord(cname) == normalizeRecord(target) {
+			return
+		}
+
+		records = append(records, cname)
+	case "MX":
+		mxs, e := resolver.LookupMX(ctx, target)
+		if e != nil {
+			err = e
+			return
+		}
+
+		for _, mx := range mxs {
+			records = append(records, mx.Host)
+		}
+	case "TXT":
+		records, err = resolver.LookupTXT(ctx, target)
+	}
+
+	return
+}
+
+func (c *checker) runCheckDns(check *stream.Check, target string) (
+	latency int, shortErr, err error) {
+
+	timeout := time.Duration(check.Timeout) * time.Second
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	var records []string
+	if check.Resolver != "" {
+		records, err = queryRecords(ctx, check.Resolver,
+			check.RecordType, target)
+	} else {
+		records, err = lookupRecords(ctx, check.RecordType, target)
+	}
+	latency = int(time.Since(start).Milliseconds())
+	if err != nil {
+		shortErr = err
+		err = &errortypes.NetworkError{
+			errors.Wrap(err, "check: Dns lookup error"),
+		}
+		return
+	}
+
+	if len(records) == 0 {
+		shortErr = fmt.Errorf("dns: no %s records", check.RecordType)
+		err = &errortypes.NotFoundError{
+			errors.Newf("check: Dns lookup returned no %s records",
+				check.RecordType),
+		}
+		return
+	}
+
+	if check.Expected == "" {
+		return
+	}
+
+	expected := normalizeRecord(check.Expected)
+	for _, record := range records {
+		record = normalizeRecord(record)
+		if record == expected ||
+			(check.RecordType == "TXT" && strings.Contains(
+				record, expected)) {
+
+			return
+		}
+	}
+
+	shortErr = fmt.Errorf("dns: expected value %s not found",
+		check.Expected)
+	err = &errortypes.VerificationError{
+		errors.Newf("check: Dns lookup missing expected value '%s'",
+			check.Expected),
+	}
+
+	return
+}
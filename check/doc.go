@@ -14,6 +14,8 @@ type Check struct {
 	CheckId string   `json:"c"`
 	Targets []string `json:"x"`
 	Latency []int    `json:"l"`
+	Loss    []int    `json:"o,omitempty"`
+	Expiry  []int    `json:"e,omitempty"`
 	Errors  []string `json:"r"`
 }
 
@@ -0,0 +1,64 @@
+package check
+
+import (
+	"github.com/pritunl/pritunl-endpoint/metrics"
+)
+
+func (d *Check) Samples() (group string, samples []*metrics.Sample) {
+	group = d.CheckId
+	samples = []*metrics.Sample{}
+
+	for i, target := range d.Targets {
+		labels := []*metrics.Label{
+			{
+				Name:  "check_id",
+				Value: d.CheckId,
+			},
+			{
+				Name:  "target",
+				Value: target,
+			},
+		}
+
+		latency := 0.0
+		if i < len(d.Latency) {
+			latency = float64(d.Latency[i])
+		}
+
+		failed := 0.0
+		if i < len(d.Errors) && d.Errors[i] != "" {
+			failed = 1
+		}
+
+		if i < len(d.Loss) {
+			samples = append(samples, &metrics.Sample{
+				Name:   metrics.MetricName(Type, "loss_percent"),
+				Labels: labels,
+				Value:  float64(d.Loss[i]),
+			})
+		}
+
+		if i < len(d.Expiry) {
+			samples = append(samples, &metrics.Sample{
+				Name:   metrics.MetricName(Type, "expiry_days"),
+				Labels: labels,
+				Value:  float64(d.Expiry[i]),
+			})
+		}
+
+		samples = append(samples,
+			&metrics.Sample{
+				Name:   metrics.MetricName(Type, "latency_ms"),
+				Labels: labels,
+				Value:  latency,
+			},
+			&metrics.Sample{
+				Name:   metrics.MetricName(Type, "failed"),
+				Labels: labels,
+				Value:  failed,
+			},
+		)
+	}
+
+	return
+}
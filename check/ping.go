@@ -0,0 +1,280 @@
+package check
+
+import (
+	"context"
+	mathrand "math/rand"
+	"net"
+	"os"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+const (
+	pingInterval = 500 * time.Millisecond
+	protoIcmp    = 1
+	protoIcmpV6  = 58
+)
+
+type pinger struct {
+	conn       *icmp.PacketConn
+	addr       net.Addr
+	ip         net.IP
+	proto      int
+	privileged bool
+	id         int
+	seq        int
+	sent       map[int]time.Time
+	rtts       []time.Duration
+}
+
+func resolvePing(target string, timeout time.Duration) (
+	ip net.IP, err error) {
+
+	ip = net.ParseIP(target)
+	if ip != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, target)
+	if err != nil {
+		err = &errortypes.NetworkError{
+			errors.Wrap(err, "check: Failed to resolve ping target"),
+		}
+		return
+	}
+
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			ip = addr.IP
+			return
+		}
+	}
+
+	if len(addrs) > 0 {
+		ip = addrs[0].IP
+		return
+	}
+
+	err = &errortypes.NetworkError{
+		errors.New("check: Ping target has no addresses"),
+	}
+	return
+}
+
+func newPinger(ip net.IP) (p *pinger, err error) {
+	p = &pinger{
+		ip:   ip,
+		id:   os.Getpid() & 0xffff,
+		seq:  mathrand.Intn(0xffff),
+		sent: map[int]time.Time{},
+	}
+
+	network := "udp4"
+	rawNetwork := "ip4:icmp"
+	listen := "0.0.0.0"
+	p.proto = protoIcmp
+	if ip.To4() == nil {
+		network = "udp6"
+		rawNetwork = "ip6:ipv6-icmp"
+		listen = "::"
+		p.proto = protoIcmpV6
+	}
+
+	p.conn, err = icmp.ListenPacket(network, listen)
+	if err != nil {
+		p.conn, err = icmp.ListenPacket(rawNetwork, listen)
+		if err != nil {
+			err = &errortypes.NetworkError{
+				errors.Wrap(err, "check: Failed to open icmp socket"),
+			}
+			return
+		}
+		p.privileged = true
+	}
+
+	if p.privileged {
+		p.addr = &net.IPAddr{
+			IP: ip,
+		}
+	} else {
+		p.addr = &net.UDPAddr{
+			IP: ip,
+		}
+	}
+
+	return
+}
+
+func (p *pinger) send() (err error) {
+	p.seq = (p.seq + 1) & 0xffff
+
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if p.proto == protoIcmpV6 {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+
+	msg := &icmp.Message{
+		Type: typ,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   p.id,
+			Seq:  p.seq,
+			Data: []byte("pritunl-endpoint"),
+		},
+	}
+
+	data, err := msg.Marshal(nil)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "check: Failed to marshal icmp message"),
+		}
+		return
+	}
+
+	p.sent[p.seq] = time.Now()
+
+	_, err = p.conn.WriteTo(data, p.addr)
+	if err != nil {
+		err = &errortypes.NetworkError{
+			errors.Wrap(err, "check: Failed to send icmp echo"),
+		}
+		return
+	}
+
+	return
+}
+
+func (p *pinger) receive(deadline time.Time) (err error) {
+	buffer := make([]byte, 1500)
+
+	for len(p.sent) > 0 {
+		err = p.conn.SetReadDeadline(deadline)
+		if err != nil {
+			err = &errortypes.NetworkError{
+				errors.Wrap(err, "check: Failed to set icmp deadline"),
+			}
+			return
+		}
+
+		n, peer, e := p.conn.ReadFrom(buffer)
+		if e != nil {
+			if netErr, ok := e.(net.Error); ok && netErr.Timeout() {
+				return
+			}
+
+			err = &errortypes.NetworkError{
+				errors.Wrap(e, "check: Failed to read icmp reply"),
+			}
+			return
+		}
+		received := time.Now()
+
+		var peerIp net.IP
+		switch addr := peer.(type) {
+		case *net.UDPAddr:
+			peerIp = addr.IP
+		case *net.IPAddr:
+			peerIp = addr.IP
+		}
+		if !peerIp.Equal(p.ip) {
+			continue
+		}
+
+		msg, e := icmp.ParseMessage(p.proto, buffer[:n])
+		if e != nil {
+			continue
+		}
+
+		if msg.Type != ipv4.ICMPTypeEchoReply &&
+			msg.Type != ipv6.ICMPTypeEchoReply {
+
+			continue
+		}
+
+		echo, ok := msg.Body.(*icmp.Echo)
+		if !ok || (p.privileged && echo.ID != p.id) {
+			continue
+		}
+
+		sent, ok := p.sent[echo.Seq]
+		if !ok {
+			continue
+		}
+		delete(p.sent, echo.Seq)
+
+		p.rtts = append(p.rtts, received.Sub(sent))
+	}
+
+	return
+}
+
+func (p *pinger) Close() {
+	_ = p.conn.Close()
+}
+
+func (c *checker) runCheckPing(check *stream.Check, target string) (
+	latency, loss int, shortErr, err error) {
+
+	timeout := time.Duration(check.Timeout) * time.Second
+
+	ip, err := resolvePing(target, timeout)
+	if err != nil {
+		shortErr = errors.RootError(err)
+		return
+	}
+
+	pngr, err := newPinger(ip)
+	if err != nil {
+		shortErr = errors.RootError(err)
+		return
+	}
+	defer pngr.Close()
+
+	for i := 0; i < check.Count; i++ {
+		err = pngr.send()
+		if err != nil {
+			shortErr = errors.RootError(err)
+			return
+		}
+
+		if i == check.Count-1 {
+			err = pngr.receive(time.Now().Add(timeout))
+		} else {
+			deadline := time.Now().Add(pingInterval)
+			err = pngr.receive(deadline)
+			time.Sleep(time.Until(deadline))
+		}
+		if err != nil {
+			shortErr = errors.RootError(err)
+			return
+		}
+	}
+
+	received := len(pngr.rtts)
+	loss = (check.Count - received) * 100 / check.Count
+
+	if received == 0 {
+		err = &errortypes.TimeoutError{
+			errors.New("check: Ping request timed out"),
+		}
+		shortErr = os.ErrDeadlineExceeded
+		return
+	}
+
+	total := time.Duration(0)
+	for _, rtt := range pngr.rtts {
+		total += rtt
+	}
+	latency = int((total / time.Duration(received)).Milliseconds())
+
+	return
+}
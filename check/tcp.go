@@ -0,0 +1,30 @@
+package check
+
+import (
+	"net"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/stream"
+)
+
+func (c *checker) runCheckTcp(check *stream.Check, target string) (
+	latency int, shortErr, err error) {
+
+	timeout := time.Duration(check.Timeout) * time.Second
+
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", target, timeout)
+	latency = int(time.Since(start).Milliseconds())
+	if err != nil {
+		shortErr = err
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "check: Tcp connect error"),
+		}
+		return
+	}
+	_ = conn.Close()
+
+	return
+}
@@ -0,0 +1,112 @@
+package check
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/stream"
+)
+
+func verifyTlsChain(host string, certs []*x509.Certificate) (err error) {
+	opts := x509.VerifyOptions{
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err = certs[0].Verify(opts)
+	if err != nil {
+		return
+	}
+
+	err = certs[0].VerifyHostname(host)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (c *checker) runCheckTls(check *stream.Check, target string) (
+	latency, expiry int, shortErr, err error) {
+
+	timeout := time.Duration(check.Timeout) * time.Second
+
+	addr := target
+	host, _, e := net.SplitHostPort(target)
+	if e != nil {
+		host = strings.Trim(target, "[]")
+		addr = net.JoinHostPort(host, "443")
+	}
+
+	dialer := &net.Dialer{
+		Timeout: timeout,
+	}
+
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		shortErr = err
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "check: Tls connect error"),
+		}
+		return
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+
+	start := time.Now()
+	err = tlsConn.Handshake()
+	latency = int(time.Since(start).Milliseconds())
+	if err != nil {
+		shortErr = err
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "check: Tls handshake error"),
+		}
+		return
+	}
+
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		shortErr = fmt.Errorf("tls: no peer certificates")
+		err = &errortypes.VerificationError{
+			errors.New("check: Tls peer sent no certificates"),
+		}
+		return
+	}
+
+	expiry = int(time.Until(certs[0].NotAfter).Hours() / 24)
+
+	err = verifyTlsChain(host, certs)
+	if err != nil {
+		shortErr = err
+		err = &errortypes.VerificationError{
+			errors.Wrap(err, "check: Tls certificate verify error"),
+		}
+		return
+	}
+
+	if expiry < check.ExpiryDays {
+		shortErr = fmt.Errorf(
+			"tls: certificate expires in %d days", expiry)
+		err = &errortypes.VerificationError{
+			errors.Newf("check: Tls certificate expires in %d days",
+				expiry),
+		}
+		return
+	}
+
+	return
+}
@@ -3,6 +3,8 @@ package config
 import (
 	"encoding/json"
 	"io/ioutil"
+	"os"
+	"sync"
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-endpoint/constants"
@@ -10,22 +12,93 @@ import (
 	"github.com/pritunl/pritunl-endpoint/utils"
 )
 
-var Config = &ConfigData{}
+var (
+	Config = &ConfigData{}
+	lock   = sync.Mutex{}
+)
 
 type Disk struct {
 	IgnorePaths []string `json:"ignore_paths"`
 	IgnoreTypes []string `json:"ignore_types"`
 }
 
+type Spool struct {
+	Disabled bool `json:"disabled"`
+	MaxSize  int  `json:"max_size"`
+	MaxAge   int  `json:"max_age"`
+}
+
+type Reconnect struct {
+	BackoffMin     int `json:"backoff_min"`
+	BackoffMax     int `json:"backoff_max"`
+	AuthBackoffMin int `json:"auth_backoff_min"`
+	AuthBackoffMax int `json:"auth_backoff_max"`
+}
+
+type Proxy struct {
+	Url      string `json:"url"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type Tls struct {
+	CaPath            string            `json:"ca_path"`
+	Pins              []string          `json:"pins"`
+	DisablePinning    bool              `json:"disable_pinning"`
+	TrustedPins       map[string]string `json:"trusted_pins"`
+	ClientCert        bool              `json:"client_cert"`
+	ClientCertPath    string            `json:"client_cert_path"`
+	ClientKeyPath     string            `json:"client_key_path"`
+	ClientCertificate string            `json:"client_certificate"`
+	ClientKey         string            `json:"client_key"`
+}
+
+type Rotation struct {
+	Disabled bool `json:"disabled"`
+	Interval int  `json:"interval"`
+	Grace    int  `json:"grace"`
+}
+
+type Metrics struct {
+	Enabled bool   `json:"enabled"`
+	Address string `json:"address"`
+}
+
+type Output struct {
+	Type       string            `json:"type"`
+	Types      []string          `json:"types"`
+	Path       string            `json:"path"`
+	Network    string            `json:"network"`
+	Address    string            `json:"address"`
+	Tag        string            `json:"tag"`
+	Url        string            `json:"url"`
+	Headers    map[string]string `json:"headers"`
+	Timeout    int               `json:"timeout"`
+	BufferSize int               `json:"buffer_size"`
+	BatchSize  int               `json:"batch_size"`
+}
+
 type ConfigData struct {
-	loaded          bool     `json:"-"`
-	Id              string   `json:"id"`
-	RemoteHosts     []string `json:"remote_hosts"`
-	Secret          string   `json:"secret"`
-	PublicKey       string   `json:"public_key"`
-	PrivateKey      string   `json:"private_key"`
-	ServerPublicKey string   `json:"server_public_key"`
-	Disk            Disk     `json:"disk"`
+	loaded                  bool      `json:"-"`
+	Id                      string    `json:"id"`
+	RemoteHosts             []string  `json:"remote_hosts"`
+	Secret                  string    `json:"secret"`
+	PublicKey               string    `json:"public_key"`
+	PrivateKey              string    `json:"private_key"`
+	ServerPublicKey         string    `json:"server_public_key"`
+	KeyTimestamp            int64     `json:"key_timestamp"`
+	PreviousPrivateKey      string    `json:"previous_private_key"`
+	PreviousServerPublicKey string    `json:"previous_server_public_key"`
+	PreviousKeyExpires      int64     `json:"previous_key_expires"`
+	Encoding                string    `json:"encoding"`
+	Disk                    Disk      `json:"disk"`
+	Spool                   Spool     `json:"spool"`
+	Reconnect               Reconnect `json:"reconnect"`
+	Proxy                   Proxy     `json:"proxy"`
+	Tls                     Tls       `json:"tls"`
+	Rotation                Rotation  `json:"rotation"`
+	Metrics                 Metrics   `json:"metrics"`
+	Outputs                 []*Output `json:"outputs"`
 }
 
 func (c *ConfigData) Save() (err error) {
@@ -44,7 +117,17 @@ func (c *ConfigData) Save() (err error) {
 		return
 	}
 
-	err = ioutil.WriteFile(constants.ConfPath, data, 0600)
+	tmpPth := constants.ConfPath + ".tmp"
+
+	err = ioutil.WriteFile(tmpPth, data, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "config: File write error"),
+		}
+		return
+	}
+
+	err = os.Rename(tmpPth, constants.ConfPath)
 	if err != nil {
 		err = &errortypes.WriteError{
 			errors.Wrap(err, "config: File write error"),
@@ -93,6 +176,26 @@ func Load() (err error) {
 }
 
 func Save() (err error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	err = Config.Save()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func Update(fn func(conf *ConfigData) error) (err error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	err = fn(Config)
+	if err != nil {
+		return
+	}
+
 	err = Config.Save()
 	if err != nil {
 		return
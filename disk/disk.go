@@ -1,6 +1,9 @@
 package disk
 
 import (
+	"context"
+	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/dropbox/godropbox/container/set"
@@ -20,12 +23,45 @@ var (
 		"aufs",
 		"squashfs",
 	}
+	optionsLock sync.Mutex
+	options     = &Options{}
 )
 
-func Handler(stream *stream.Stream) (err error) {
+type Options struct {
+	IgnorePaths []string `json:"ignore_paths"`
+	IgnoreTypes []string `json:"ignore_types"`
+}
+
+func Configure(data json.RawMessage) (err error) {
+	opts := &Options{}
+
+	if len(data) > 0 {
+		err = json.Unmarshal(data, opts)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "disk: Failed to parse options"),
+			}
+			return
+		}
+	}
+
+	optionsLock.Lock()
+	options = opts
+	optionsLock.Unlock()
+
+	return
+}
+
+func Handler(ctx context.Context, stream *stream.Stream) (err error) {
+	optionsLock.Lock()
+	opts := options
+	optionsLock.Unlock()
+
 	ignoreTypes := ignoreTypesDefault
 	confIgnoreTypes := config.Config.Disk.IgnoreTypes
-	if confIgnoreTypes != nil {
+	if opts.IgnoreTypes != nil {
+		ignoreTypes = opts.IgnoreTypes
+	} else if confIgnoreTypes != nil {
 		ignoreTypes = confIgnoreTypes
 	}
 
@@ -36,7 +72,9 @@ func Handler(stream *stream.Stream) (err error) {
 
 	ignorePaths := []string{}
 	confIgnorePaths := config.Config.Disk.IgnorePaths
-	if confIgnorePaths != nil {
+	if opts.IgnorePaths != nil {
+		ignorePaths = opts.IgnorePaths
+	} else if confIgnorePaths != nil {
 		ignorePaths = confIgnorePaths
 	}
 
@@ -45,7 +83,7 @@ func Handler(stream *stream.Stream) (err error) {
 		ignorePathsSet.Add(ignoreType)
 	}
 
-	parts, err := disk.Partitions(false)
+	parts, err := disk.PartitionsWithContext(ctx, false)
 	if err != nil {
 		err = &errortypes.ReadError{
 			errors.Wrap(err, "load: Failed to get disk partitions"),
@@ -69,7 +107,7 @@ func Handler(stream *stream.Stream) (err error) {
 	}
 
 	for _, mountpoint := range mountpoints {
-		usage, e := disk.Usage(mountpoint)
+		usage, e := disk.UsageWithContext(ctx, mountpoint)
 		if e != nil {
 			continue
 		}
@@ -89,12 +127,39 @@ func Handler(stream *stream.Stream) (err error) {
 	return
 }
 
-func Register() {
-	in := &input.Input{
-		Name:    Type,
-		Rate:    60 * time.Second,
-		Handler: Handler,
+type Input struct {
+	input.Base
+}
+
+func (i *Input) Name() string {
+	return Type
+}
+
+func (i *Input) Rate() time.Duration {
+	return 60 * time.Second
+}
+
+func (i *Input) Collect(ctx context.Context) error {
+	return Handler(ctx, i.Stream)
+}
+
+func (i *Input) Reconfigure(conf *stream.InputConf) (err error) {
+	var options json.RawMessage
+	if conf != nil {
+		options = conf.Options
+	}
+
+	err = Configure(options)
+	if err != nil {
+		return
 	}
 
-	input.Register(in)
+	return
+}
+
+func Register() {
+	stream.RegisterDoc(Type, func() stream.Doc {
+		return &Disk{}
+	})
+	input.Register(&Input{})
 }
@@ -1,6 +1,7 @@
 package diskio
 
 import (
+	"context"
 	"strings"
 	"time"
 	"unicode"
@@ -16,8 +17,8 @@ var (
 	prev map[string]disk.IOCountersStat
 )
 
-func Handler(stream *stream.Stream) (err error) {
-	stats, err := disk.IOCounters()
+func Handler(ctx context.Context, stream *stream.Stream) (err error) {
+	stats, err := disk.IOCountersWithContext(ctx)
 	if err != nil {
 		err = &errortypes.ParseError{
 			errors.Wrap(err, "diskio: Failed to get disk io"),
@@ -88,12 +89,25 @@ func Handler(stream *stream.Stream) (err error) {
 	return
 }
 
-func Register() {
-	in := &input.Input{
-		Name:    Type,
-		Rate:    60 * time.Second,
-		Handler: Handler,
-	}
+type Input struct {
+	input.Base
+}
+
+func (i *Input) Name() string {
+	return Type
+}
 
-	input.Register(in)
+func (i *Input) Rate() time.Duration {
+	return 60 * time.Second
+}
+
+func (i *Input) Collect(ctx context.Context) error {
+	return Handler(ctx, i.Stream)
+}
+
+func Register() {
+	stream.RegisterDoc(Type, func() stream.Doc {
+		return &DiskIo{}
+	})
+	input.Register(&Input{})
 }
@@ -0,0 +1,179 @@
+package endpoint
+
+import (
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/remote"
+	"github.com/pritunl/pritunl-endpoint/transport"
+	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	certificateCheckRate = 1 * time.Hour
+	certificateRenewMin  = 7 * 24 * time.Hour
+)
+
+type CertificateData struct {
+	authData
+	Csr         string `json:"csr,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
+}
+
+func renewCertificate(host, csr string) (certPem string,
+	retry bool, err error) {
+
+	reqData := &CertificateData{
+		Csr: csr,
+	}
+
+	resData := &CertificateData{}
+	_, retry, err = signedRequest(host, "certificate", "Certificate renew",
+		reqData, []string{
+			reqData.Csr,
+		}, resData, func() []string {
+			return []string{
+				resData.Certificate,
+			}
+		})
+	if err != nil {
+		return
+	}
+
+	if resData.Certificate == "" {
+		err = &errortypes.ParseError{
+			errors.New("endpoint: Response missing certificate"),
+		}
+		return
+	}
+
+	certPem = resData.Certificate
+
+	return
+}
+
+func RenewCertificate() (err error) {
+	clientKey, csr, err := transport.GenerateClientKey()
+	if err != nil {
+		return
+	}
+
+	certPem := ""
+	for _, host := range remote.Hosts() {
+		retry := false
+		certPem, retry, err = renewCertificate(host, csr)
+		if err != nil {
+			if retry {
+				remote.Failure(host)
+
+				logrus.WithFields(logrus.Fields{
+					"pritunl_zero_host": host,
+					"error":             err,
+				}).Error("endpoint: Certificate renew failed, " +
+					"trying next host")
+				continue
+			}
+			return
+		}
+
+		remote.Success(host)
+		break
+	}
+
+	if err != nil {
+		return
+	}
+
+	if certPem == "" {
+		err = &errortypes.ParseError{
+			errors.New("endpoint: Config missing remote host"),
+		}
+		return
+	}
+
+	err = config.Update(func(c *config.ConfigData) (err error) {
+		err = transport.SetClientCert(certPem, clientKey)
+		if err != nil {
+			return
+		}
+
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	expires, _, _ := transport.ClientCertExpires()
+	logrus.WithFields(logrus.Fields{
+		"expires": expires,
+	}).Info("endpoint: Client certificate renewed")
+
+	return
+}
+
+func certificateRenewRequired() (required bool, err error) {
+	expires, lifetime, err := transport.ClientCertExpires()
+	if err != nil {
+		return
+	}
+
+	if expires.IsZero() {
+		required = true
+		return
+	}
+
+	renewBefore := lifetime / 3
+	if renewBefore > certificateRenewMin {
+		renewBefore = certificateRenewMin
+	}
+
+	required = time.Until(expires) < renewBefore
+
+	return
+}
+
+func certificateRunner() {
+	backoff := &utils.Backoff{
+		Min: 1 * time.Minute,
+		Max: certificateCheckRate,
+	}
+
+	for {
+		delay := certificateCheckRate
+
+		required, err := certificateRenewRequired()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("endpoint: Failed to load client certificate")
+			required = true
+		}
+
+		if required {
+			err = RenewCertificate()
+			if err != nil {
+				delay = backoff.Next()
+
+				logrus.WithFields(logrus.Fields{
+					"retry": delay.String(),
+					"error": err,
+				}).Error("endpoint: Failed to renew client certificate")
+			} else {
+				backoff.Reset()
+			}
+		}
+
+		time.Sleep(delay)
+	}
+}
+
+func StartCertificateRenew() {
+	if !transport.ClientCertEnabled() || transport.ClientCertExternal() {
+		return
+	}
+
+	go certificateRunner()
+}
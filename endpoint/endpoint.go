@@ -1,50 +1,44 @@
 package endpoint
 
 import (
-	"bytes"
-	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha512"
-	"crypto/subtle"
-	"crypto/tls"
 	"encoding/base64"
-	"encoding/json"
-	"fmt"
 	"net/http"
-	"net/url"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-endpoint/config"
 	"github.com/pritunl/pritunl-endpoint/errortypes"
-	"github.com/pritunl/pritunl-endpoint/nonce"
-	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/pritunl/pritunl-endpoint/remote"
+	"github.com/pritunl/pritunl-endpoint/transport"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/nacl/box"
 )
 
-var (
-	clientTransport = &http.Transport{
-		DisableKeepAlives:   true,
-		TLSHandshakeTimeout: 5 * time.Second,
-		TLSClientConfig: &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			MaxVersion: tls.VersionTLS13,
-		},
+func newClient() (client *http.Client, err error) {
+	tlsConf, err := transport.TlsConfig()
+	if err != nil {
+		return
 	}
+
 	client = &http.Client{
-		Transport: clientTransport,
-		Timeout:   10 * time.Second,
+		Transport: &http.Transport{
+			Proxy:               transport.Proxy,
+			DisableKeepAlives:   true,
+			TLSHandshakeTimeout: 5 * time.Second,
+			TLSClientConfig:     tlsConf,
+		},
+		Timeout: 10 * time.Second,
 	}
-)
+
+	return
+}
 
 type RegisterData struct {
-	Timestamp int64  `json:"timestamp"`
-	Nonce     string `json:"nonce"`
-	PublicKey string `json:"public_key"`
-	Signature string `json:"signature"`
+	authData
+	PublicKey   string `json:"public_key"`
+	Csr         string `json:"csr,omitempty"`
+	Certificate string `json:"certificate,omitempty"`
 }
 
 func GenerateKey() (pubKey64, privKey64 string, err error) {
@@ -62,157 +56,144 @@ func GenerateKey() (pubKey64, privKey64 string, err error) {
 	return
 }
 
-func Register() (err error) {
-	pubKey, privKey, err := GenerateKey()
-	if err != nil {
-		return
-	}
-
-	regNonce, err := utils.RandStr(64)
-	if err != nil {
-		return
-	}
+func register(host, pubKey, csr string) (resData *RegisterData,
+	pin string, retry bool, err error) {
 
 	regData := &RegisterData{
-		Timestamp: time.Now().Unix(),
-		Nonce:     regNonce,
 		PublicKey: pubKey,
+		Csr:       csr,
 	}
 
-	authString := strings.Join([]string{
-		strconv.FormatInt(regData.Timestamp, 10),
-		regData.Nonce,
+	authParts := []string{
 		regData.PublicKey,
-	}, "&")
-
-	hashFunc := hmac.New(sha512.New, []byte(config.Config.Secret))
-	hashFunc.Write([]byte(authString))
-	rawSignature := hashFunc.Sum(nil)
-	regData.Signature = base64.StdEncoding.EncodeToString(rawSignature)
+	}
+	if regData.Csr != "" {
+		authParts = append(authParts, regData.Csr)
+	}
 
-	reqData, err := json.Marshal(regData)
+	resData = &RegisterData{}
+	peerCerts, retry, err := signedRequest(host, "register", "Register",
+		regData, authParts, resData, func() []string {
+			parts := []string{
+				resData.PublicKey,
+			}
+			if resData.Certificate != "" {
+				parts = append(parts, resData.Certificate)
+			}
+			return parts
+		})
 	if err != nil {
-		err = &errortypes.ParseError{
-			errors.Wrap(err, "endpoint: Failed to marshal data"),
+		resData = nil
+		return
+	}
+
+	if len(resData.PublicKey) < 16 || len(resData.PublicKey) > 512 {
+		resData = nil
+		err = &errortypes.AuthenticationError{
+			errors.New("endpoint: Invalid public key"),
 		}
 		return
 	}
 
-	u := &url.URL{
-		Scheme: "https",
-		Host:   config.Config.RemoteHosts[0],
-		Path:   fmt.Sprintf("/endpoint/%s/register", config.Config.Id),
+	if len(peerCerts) > 0 {
+		pin = transport.GetPin(peerCerts[0])
 	}
 
-	req, err := http.NewRequest(
-		"PUT",
-		u.String(),
-		bytes.NewBuffer(reqData),
-	)
+	return
+}
+
+func Register() (err error) {
+	pubKey, privKey, err := GenerateKey()
 	if err != nil {
-		err = &errortypes.RequestError{
-			errors.Wrap(err, "endpoint: Request put error"),
-		}
 		return
 	}
 
-	req.Header.Set("User-Agent", "pritunl-endpoint")
-	req.Header.Set("Content-Type", "application/json")
-
-	res, err := client.Do(req)
-	if err != nil {
-		err = &errortypes.RequestError{
-			errors.Wrap(err, "endpoint: Request put error"),
+	clientKey := ""
+	csr := ""
+	if transport.ClientCertEnabled() && !transport.ClientCertExternal() {
+		clientKey, csr, err = transport.GenerateClientKey()
+		if err != nil {
+			return
 		}
-		return
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		if res.StatusCode == 404 {
-			logrus.WithFields(logrus.Fields{
-				"error_code": "endpoint_not_found",
-				"error_msg":  "Endpoint does not exist",
-			}).Error("endpoint: Register error")
-		} else if res.StatusCode >= 400 && res.StatusCode < 500 {
-			errData := &errortypes.ErrorData{}
-			e := json.NewDecoder(res.Body).Decode(errData)
-			if e == nil {
+
+	var resData *RegisterData
+	pin := ""
+	pinHost := ""
+	for _, host := range remote.Hosts() {
+		retry := false
+		resData, pin, retry, err = register(host, pubKey, csr)
+		if err != nil {
+			if retry {
+				remote.Failure(host)
+
 				logrus.WithFields(logrus.Fields{
-					"error_code": errData.Error,
-					"error_msg":  errData.Message,
-				}).Error("endpoint: Register error")
+					"pritunl_zero_host": host,
+					"error":             err,
+				}).Error("endpoint: Register failed, trying next host")
+				continue
 			}
+			return
 		}
 
-		err = &errortypes.RequestError{
-			errors.Wrapf(err, "endpoint: Bad status %d code from server",
-				res.StatusCode),
-		}
-		return
+		remote.Success(host)
+		pinHost = host
+		break
 	}
 
-	resData := &RegisterData{}
-	err = json.NewDecoder(res.Body).Decode(resData)
 	if err != nil {
-		err = &errortypes.ParseError{
-			errors.Wrap(err, "endpoint: Failed to parse response body"),
-		}
 		return
 	}
 
-	if len(resData.Nonce) < 16 || len(resData.Nonce) > 128 {
-		err = &errortypes.AuthenticationError{
-			errors.New("endpoint: Invalid authentication nonce"),
-		}
-		return
-	}
-
-	if len(resData.PublicKey) < 16 || len(resData.PublicKey) > 512 {
-		err = &errortypes.AuthenticationError{
-			errors.New("endpoint: Invalid public key"),
+	if resData == nil {
+		err = &errortypes.ParseError{
+			errors.New("endpoint: Config missing remote host"),
 		}
 		return
 	}
 
-	timestamp := time.Unix(resData.Timestamp, 0)
-	if utils.SinceAbs(timestamp) > 300*time.Second {
-		err = &errortypes.AuthenticationError{
-			errors.New("endpoint: Authentication timestamp outside window"),
+	err = config.Update(func(c *config.ConfigData) (err error) {
+		c.PublicKey = pubKey
+		c.PrivateKey = privKey
+		c.ServerPublicKey = resData.PublicKey
+		c.KeyTimestamp = time.Now().Unix()
+		c.PreviousPrivateKey = ""
+		c.PreviousServerPublicKey = ""
+		c.PreviousKeyExpires = 0
+
+		if csr != "" {
+			if resData.Certificate == "" {
+				logrus.Warn(
+					"endpoint: Server did not issue client certificate")
+			} else {
+				err = transport.SetClientCert(resData.Certificate, clientKey)
+				if err != nil {
+					return
+				}
+			}
 		}
-		return
-	}
 
-	authString = strings.Join([]string{
-		strconv.FormatInt(resData.Timestamp, 10),
-		resData.Nonce,
-		resData.PublicKey,
-	}, "&")
-
-	err = nonce.Validate(resData.Nonce)
-	if err != nil {
-		return
-	}
+		if !c.Tls.DisablePinning && len(c.Tls.Pins) == 0 && pin != "" {
+			serverName := transport.ServerName(pinHost)
 
-	hashFunc = hmac.New(sha512.New, []byte(config.Config.Secret))
-	hashFunc.Write([]byte(authString))
-	rawSignature = hashFunc.Sum(nil)
-	testSig := base64.StdEncoding.EncodeToString(rawSignature)
+			trustedPins := map[string]string{}
+			for name, trustedPin := range c.Tls.TrustedPins {
+				trustedPins[name] = trustedPin
+			}
 
-	if subtle.ConstantTimeCompare(
-		[]byte(testSig), []byte(resData.Signature)) != 1 {
+			if trustedPins[serverName] == "" {
+				trustedPins[serverName] = pin
+				c.Tls.TrustedPins = trustedPins
 
-		err = &errortypes.ParseError{
-			errors.Wrap(err, "endpoint: Response signature invalid"),
+				logrus.WithFields(logrus.Fields{
+					"pritunl_zero_host": serverName,
+					"pin":               pin,
+				}).Info("endpoint: Pinned server certificate")
+			}
 		}
-		return
-	}
 
-	config.Config.PublicKey = pubKey
-	config.Config.PrivateKey = privKey
-	config.Config.ServerPublicKey = resData.PublicKey
-
-	err = config.Save()
+		return
+	})
 	if err != nil {
 		return
 	}
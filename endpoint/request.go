@@ -0,0 +1,199 @@
+package endpoint
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/nonce"
+	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/sirupsen/logrus"
+)
+
+type authData struct {
+	Timestamp int64  `json:"timestamp"`
+	Nonce     string `json:"nonce"`
+	Signature string `json:"signature"`
+}
+
+func (a *authData) getAuth() *authData {
+	return a
+}
+
+type signedData interface {
+	getAuth() *authData
+}
+
+func signature(timestamp int64, nonc string, parts []string) string {
+	authString := strings.Join(append([]string{
+		strconv.FormatInt(timestamp, 10),
+		nonc,
+	}, parts...), "&")
+
+	hashFunc := hmac.New(sha512.New, []byte(config.Config.Secret))
+	hashFunc.Write([]byte(authString))
+	rawSignature := hashFunc.Sum(nil)
+
+	return base64.StdEncoding.EncodeToString(rawSignature)
+}
+
+func (a *authData) sign(parts ...string) (err error) {
+	reqNonce, err := utils.RandStr(64)
+	if err != nil {
+		return
+	}
+
+	a.Timestamp = time.Now().Unix()
+	a.Nonce = reqNonce
+	a.Signature = signature(a.Timestamp, a.Nonce, parts)
+
+	return
+}
+
+func (a *authData) verify(parts ...string) (err error) {
+	if len(a.Nonce) < 16 || len(a.Nonce) > 128 {
+		err = &errortypes.AuthenticationError{
+			errors.New("endpoint: Invalid authentication nonce"),
+		}
+		return
+	}
+
+	timestamp := time.Unix(a.Timestamp, 0)
+	if utils.SinceAbs(timestamp) > 300*time.Second {
+		err = &errortypes.AuthenticationError{
+			errors.New("endpoint: Authentication timestamp outside window"),
+		}
+		return
+	}
+
+	err = nonce.ValidateTimestamp(a.Nonce, timestamp)
+	if err != nil {
+		return
+	}
+
+	testSig := signature(a.Timestamp, a.Nonce, parts)
+
+	if subtle.ConstantTimeCompare(
+		[]byte(testSig), []byte(a.Signature)) != 1 {
+
+		err = &errortypes.AuthenticationError{
+			errors.New("endpoint: Response signature invalid"),
+		}
+		return
+	}
+
+	return
+}
+
+func signedRequest(host, action, label string, reqData signedData,
+	reqParts []string, resData signedData, resParts func() []string) (
+	peerCerts []*x509.Certificate, retry bool, err error) {
+
+	err = reqData.getAuth().sign(reqParts...)
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(reqData)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "endpoint: Failed to marshal data"),
+		}
+		return
+	}
+
+	u := &url.URL{
+		Scheme: "https",
+		Host:   host,
+		Path: fmt.Sprintf("/endpoint/%s/%s",
+			config.Config.Id, action),
+	}
+
+	req, err := http.NewRequest(
+		"PUT",
+		u.String(),
+		bytes.NewBuffer(data),
+	)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "endpoint: Request put error"),
+		}
+		return
+	}
+
+	req.Header.Set("User-Agent", "pritunl-endpoint")
+	req.Header.Set("Content-Type", "application/json")
+
+	client, err := newClient()
+	if err != nil {
+		return
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		retry = true
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "endpoint: Request put error"),
+		}
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		if res.StatusCode >= 400 && res.StatusCode < 500 {
+			errData := &errortypes.ErrorData{}
+			e := json.NewDecoder(res.Body).Decode(errData)
+			if e == nil {
+				logrus.WithFields(logrus.Fields{
+					"error_code": errData.Error,
+					"error_msg":  errData.Message,
+				}).Errorf("endpoint: %s error", label)
+			} else if res.StatusCode == 404 {
+				logrus.WithFields(logrus.Fields{
+					"error_code": "endpoint_not_found",
+					"error_msg":  "Endpoint does not exist",
+				}).Errorf("endpoint: %s error", label)
+			}
+		} else {
+			retry = true
+		}
+
+		err = &errortypes.RequestError{
+			errors.Newf("endpoint: Bad status %d code from server",
+				res.StatusCode),
+		}
+		return
+	}
+
+	err = json.NewDecoder(res.Body).Decode(resData)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "endpoint: Failed to parse response body"),
+		}
+		return
+	}
+
+	err = resData.getAuth().verify(resParts()...)
+	if err != nil {
+		return
+	}
+
+	if res.TLS != nil {
+		peerCerts = res.TLS.PeerCertificates
+	}
+
+	return
+}
@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/remote"
+	"github.com/sirupsen/logrus"
+)
+
+type RotateData struct {
+	authData
+	PublicKey string `json:"public_key"`
+}
+
+func rotateKey(host, pubKey string) (resData *RotateData,
+	retry bool, err error) {
+
+	reqData := &RotateData{
+		PublicKey: pubKey,
+	}
+
+	resData = &RotateData{}
+	_, retry, err = signedRequest(host, "rotate", "Key rotate",
+		reqData, []string{
+			config.Config.PublicKey,
+			reqData.PublicKey,
+		}, resData, func() []string {
+			return []string{
+				reqData.PublicKey,
+				resData.PublicKey,
+			}
+		})
+	if err != nil {
+		resData = nil
+		return
+	}
+
+	if len(resData.PublicKey) < 16 || len(resData.PublicKey) > 512 {
+		resData = nil
+		err = &errortypes.AuthenticationError{
+			errors.New("endpoint: Invalid public key"),
+		}
+		return
+	}
+
+	return
+}
+
+func RotateKey(grace time.Duration) (err error) {
+	pubKey, privKey, err := GenerateKey()
+	if err != nil {
+		return
+	}
+
+	var resData *RotateData
+	for _, host := range remote.Hosts() {
+		retry := false
+		resData, retry, err = rotateKey(host, pubKey)
+		if err != nil {
+			if retry {
+				remote.Failure(host)
+
+				logrus.WithFields(logrus.Fields{
+					"pritunl_zero_host": host,
+					"error":             err,
+				}).Error("endpoint: Key rotate failed, trying next host")
+				continue
+			}
+			return
+		}
+
+		remote.Success(host)
+		break
+	}
+
+	if err != nil {
+		return
+	}
+
+	if resData == nil {
+		err = &errortypes.ParseError{
+			errors.New("endpoint: Config missing remote host"),
+		}
+		return
+	}
+
+	err = config.Update(func(c *config.ConfigData) (err error) {
+		c.PreviousPrivateKey = c.PrivateKey
+		c.PreviousServerPublicKey = c.ServerPublicKey
+		c.PreviousKeyExpires = time.Now().Add(grace).Unix()
+		c.PublicKey = pubKey
+		c.PrivateKey = privKey
+		c.ServerPublicKey = resData.PublicKey
+		c.KeyTimestamp = time.Now().Unix()
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	logrus.Info("endpoint: Rotated endpoint key")
+
+	return
+}
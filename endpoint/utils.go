@@ -4,11 +4,14 @@ import (
 	"flag"
 	"fmt"
 	"net/url"
+	"path/filepath"
 	"strings"
 
 	"github.com/dropbox/godropbox/errors"
 	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/constants"
 	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/utils"
 	"github.com/sirupsen/logrus"
 )
 
@@ -41,35 +44,50 @@ func RegisterCmd() (err error) {
 			return
 		}
 
-		config.Config.RemoteHosts = []string{u.Host}
-		config.Config.Id = registerKeys[0]
-		config.Config.Secret = registerKeys[1]
-		config.Config.PublicKey = ""
-		config.Config.PrivateKey = ""
-		config.Config.ServerPublicKey = ""
-
-		err = config.Save()
+		err = config.Update(func(c *config.ConfigData) (err error) {
+			c.RemoteHosts = []string{u.Host}
+			c.Id = registerKeys[0]
+			c.Secret = registerKeys[1]
+			c.PublicKey = ""
+			c.PrivateKey = ""
+			c.ServerPublicKey = ""
+			c.Tls.TrustedPins = nil
+			c.Tls.ClientCertificate = ""
+			c.Tls.ClientKey = ""
+			return
+		})
 		if err != nil {
 			return
 		}
 	} else {
-		hostname := ""
-		fmt.Print("Enter Pritunl Zero hostname: ")
-		fmt.Scan(&hostname)
-
-		if strings.HasPrefix(hostname, "https://") {
-			u, e := url.Parse(hostname)
-			if e != nil {
-				err = &errortypes.ParseError{
-					errors.Wrap(e, "endpoint: Failed to parse input"),
+		hostnamesInput := ""
+		fmt.Print("Enter Pritunl Zero hostnames (comma separated): ")
+		fmt.Scan(&hostnamesInput)
+
+		hostnames := []string{}
+		for _, hostname := range strings.Split(hostnamesInput, ",") {
+			hostname = strings.TrimSpace(hostname)
+
+			if strings.HasPrefix(hostname, "https://") {
+				u, e := url.Parse(hostname)
+				if e != nil {
+					err = &errortypes.ParseError{
+						errors.Wrap(e, "endpoint: Failed to parse input"),
+					}
+					return
 				}
-				return
+
+				hostname = u.Host
+			}
+
+			if hostname == "" {
+				continue
 			}
 
-			hostname = u.Host
+			hostnames = append(hostnames, hostname)
 		}
 
-		if hostname == "" {
+		if len(hostnames) == 0 {
 			err = &errortypes.ParseError{
 				errors.New("endpoint: Invalid hostname"),
 			}
@@ -95,22 +113,31 @@ func RegisterCmd() (err error) {
 			return
 		}
 
-		config.Config.RemoteHosts = []string{hostname}
-		config.Config.Id = registerKeys[0]
-		config.Config.Secret = registerKeys[1]
-		config.Config.PublicKey = ""
-		config.Config.PrivateKey = ""
-		config.Config.ServerPublicKey = ""
-
-		err = config.Save()
+		err = config.Update(func(c *config.ConfigData) (err error) {
+			c.RemoteHosts = hostnames
+			c.Id = registerKeys[0]
+			c.Secret = registerKeys[1]
+			c.PublicKey = ""
+			c.PrivateKey = ""
+			c.ServerPublicKey = ""
+			c.Tls.TrustedPins = nil
+			c.Tls.ClientCertificate = ""
+			c.Tls.ClientKey = ""
+			return
+		})
 		if err != nil {
 			return
 		}
 	}
 
+	err = utils.ExistsRemove(filepath.Join(constants.VarDir, "conf.json"))
+	if err != nil {
+		return
+	}
+
 	logrus.WithFields(logrus.Fields{
-		"endpoint_id":       config.Config.Id,
-		"pritunl_zero_host": config.Config.RemoteHosts[0],
+		"endpoint_id":        config.Config.Id,
+		"pritunl_zero_hosts": strings.Join(config.Config.RemoteHosts, ","),
 	}).Info("endpoint: Registration key saved")
 
 	return
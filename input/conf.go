@@ -0,0 +1,93 @@
+package input
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	rateMin = 5 * time.Second
+	rateMax = 24 * time.Hour
+)
+
+func (r *runner) applyConf(strm *stream.Stream, conf *stream.InputConf) {
+	enabled := true
+	rate := r.input.Rate()
+	if rate < rateMin {
+		rate = rateMin
+	}
+	var options json.RawMessage
+
+	if conf != nil {
+		if conf.Enabled != nil {
+			enabled = *conf.Enabled
+		}
+
+		if conf.Rate > 0 {
+			rate = time.Duration(conf.Rate) * time.Second
+			if rate < rateMin {
+				rate = rateMin
+			} else if rate > rateMax {
+				rate = rateMax
+			}
+		}
+
+		options = conf.Options
+	}
+
+	curRate := r.getRate()
+	if rate != curRate {
+		if curRate != 0 {
+			logrus.WithFields(logrus.Fields{
+				"input": r.name,
+				"rate":  rate.String(),
+			}).Info("input: Input rate updated")
+		}
+		r.setRate(rate)
+	}
+
+	if !bytes.Equal(options, r.options) {
+		err := r.input.Reconfigure(conf)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"input": r.name,
+				"error": err,
+			}).Error("input: Input configure error")
+		} else {
+			r.options = options
+		}
+	}
+
+	if enabled {
+		if !r.started {
+			if r.configured {
+				logrus.WithFields(logrus.Fields{
+					"input": r.name,
+				}).Info("input: Input enabled")
+			}
+			r.start(strm)
+		}
+	} else if r.started || !r.configured {
+		logrus.WithFields(logrus.Fields{
+			"input": r.name,
+		}).Info("input: Input disabled")
+		r.stop()
+	}
+
+	r.configured = true
+}
+
+func applyConf(strm *stream.Stream, conf *stream.Conf) {
+	for _, run := range runners {
+		var inConf *stream.InputConf
+		if conf != nil && conf.Inputs != nil {
+			inConf = conf.Inputs[run.name]
+		}
+
+		run.applyConf(strm, inConf)
+	}
+}
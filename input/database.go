@@ -1,7 +1,7 @@
 package input
 
-var inputs = []*Input{}
+var runners = []*runner{}
 
-func Register(in *Input) {
-	inputs = append(inputs, in)
+func Register(in Input) {
+	runners = append(runners, newRunner(in))
 }
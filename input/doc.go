@@ -0,0 +1,38 @@
+package input
+
+import (
+	"time"
+)
+
+const (
+	HealthType = "input_health"
+)
+
+type InputHealth struct {
+	Name        string    `json:"n"`
+	State       string    `json:"s"`
+	Panics      int64     `json:"p"`
+	Errors      int64     `json:"e"`
+	Restarts    int64     `json:"r"`
+	Missed      int64     `json:"m"`
+	LastError   string    `json:"le"`
+	LastSuccess time.Time `json:"ls"`
+}
+
+type Health struct {
+	Timestamp time.Time `json:"t"`
+
+	Inputs []*InputHealth `json:"i"`
+}
+
+func (d *Health) GetTimestamp() time.Time {
+	return d.Timestamp
+}
+
+func (d *Health) SetTimestamp(timestamp time.Time) {
+	d.Timestamp = timestamp
+}
+
+func (d *Health) GetType() string {
+	return HealthType
+}
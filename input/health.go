@@ -0,0 +1,112 @@
+package input
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	healthRate = 60 * time.Second
+)
+
+const (
+	stateRunning    = "running"
+	stateFailed     = "failed"
+	stateRestarting = "restarting"
+	stateDisabled   = "disabled"
+)
+
+func (r *runner) protect(fn func() error) (panicked bool, err error) {
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+
+		panicked = true
+		err = &errortypes.UnknownError{
+			errors.Newf("input: Input panic '%v'", rec),
+		}
+
+		r.lock.Lock()
+		r.panics += 1
+		r.lock.Unlock()
+
+		logrus.WithFields(logrus.Fields{
+			"input": r.name,
+			"panic": fmt.Sprint(rec),
+			"stack": string(debug.Stack()),
+		}).Error("input: Input panic recovered")
+	}()
+
+	err = fn()
+
+	return
+}
+
+func (r *runner) setState(state string) {
+	r.lock.Lock()
+	r.state = state
+	r.lock.Unlock()
+}
+
+func (r *runner) recordSuccess() {
+	r.lock.Lock()
+	r.lastSuccess = time.Now()
+	r.state = stateRunning
+	r.lock.Unlock()
+}
+
+func (r *runner) recordError(err error) {
+	r.lock.Lock()
+	r.errors += 1
+	r.lastError = errors.GetMessage(err)
+	r.lock.Unlock()
+}
+
+func (r *runner) recordRestart() {
+	r.lock.Lock()
+	r.restarts += 1
+	r.state = stateRestarting
+	r.lock.Unlock()
+}
+
+func (r *runner) health() *InputHealth {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return &InputHealth{
+		Name:        r.name,
+		State:       r.state,
+		Panics:      r.panics,
+		Errors:      r.errors,
+		Restarts:    r.restarts,
+		Missed:      r.missed,
+		LastError:   r.lastError,
+		LastSuccess: r.lastSuccess,
+	}
+}
+
+func GetHealth() (healths []*InputHealth) {
+	healths = []*InputHealth{}
+
+	for _, run := range runners {
+		healths = append(healths, run.health())
+	}
+
+	return
+}
+
+func sendHealth(strm *stream.Stream) {
+	doc := &Health{
+		Inputs: GetHealth(),
+	}
+
+	strm.Append(doc)
+}
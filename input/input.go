@@ -1,52 +1,104 @@
 package input
 
 import (
+	"context"
+	"sync"
 	"time"
 
 	"github.com/pritunl/pritunl-endpoint/stream"
 	"github.com/sirupsen/logrus"
 )
 
-type Input struct {
-	Name     string
-	Rate     time.Duration
-	Startup  func(stream *stream.Stream) error
-	Handler  func(stream *stream.Stream) error
-	timstamp time.Time
+const (
+	shutdownTimeout = 15 * time.Second
+)
+
+var (
+	stop     = make(chan struct{})
+	stopOnce sync.Once
+)
+
+type Input interface {
+	Name() string
+	Rate() time.Duration
+	Start(ctx context.Context, strm *stream.Stream) error
+	Collect(ctx context.Context) error
+	Reconfigure(conf *stream.InputConf) error
+	Stop() error
 }
 
-func Run() {
-	strm := stream.New()
-	go strm.Run()
+type Base struct {
+	Stream *stream.Stream
+}
 
-	for _, in := range inputs {
-		if in.Startup != nil {
-			err := in.Startup(strm)
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"error": err,
-				}).Error("input: Input startup error")
-			}
-		}
+func (b *Base) Rate() time.Duration {
+	return 0
+}
+
+func (b *Base) Start(ctx context.Context, strm *stream.Stream) error {
+	b.Stream = strm
+	return nil
+}
+
+func (b *Base) Collect(ctx context.Context) error {
+	return nil
+}
+
+func (b *Base) Reconfigure(conf *stream.InputConf) error {
+	return nil
+}
+
+func (b *Base) Stop() error {
+	return nil
+}
+
+func shutdown(strm *stream.Stream) {
+	logrus.Info("input: Stopping inputs")
+
+	for _, run := range runners {
+		run.stop()
 	}
 
+	logrus.Info("input: Draining stream")
+
+	strm.Close(shutdownTimeout)
+}
+
+func Stop() {
+	stopOnce.Do(func() {
+		close(stop)
+	})
+}
+
+func Run(strm *stream.Stream) {
+	stream.RegisterDoc(HealthType, func() stream.Doc {
+		return &Health{}
+	})
+
+	go strm.Run()
+
+	conf := stream.CurrentConf
+	applyConf(strm, conf)
+
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	healthTicker := time.NewTicker(healthRate)
+	defer healthTicker.Stop()
+
 	for {
-		for _, in := range inputs {
-			if in.Handler == nil {
-				continue
-			}
-
-			if time.Since(in.timstamp) > in.Rate {
-				in.timstamp = time.Now()
-
-				err := in.Handler(strm)
-				if err != nil {
-					logrus.WithFields(logrus.Fields{
-						"error": err,
-					}).Error("input: Input handler error")
-				}
-			}
+		if stream.CurrentConf != conf {
+			conf = stream.CurrentConf
+			applyConf(strm, conf)
+		}
+
+		select {
+		case <-stop:
+			shutdown(strm)
+			return
+		case <-ticker.C:
+		case <-healthTicker.C:
+			sendHealth(strm)
 		}
-		time.Sleep(1 * time.Second)
 	}
 }
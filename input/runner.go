@@ -0,0 +1,140 @@
+package input
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	restartBackoffMin = 5 * time.Second
+	restartBackoffMax = 5 * time.Minute
+)
+
+type runner struct {
+	input       Input
+	name        string
+	lock        sync.Mutex
+	rate        time.Duration
+	running     bool
+	missed      int64
+	panics      int64
+	errors      int64
+	restarts    int64
+	state       string
+	lastError   string
+	lastSuccess time.Time
+	cancel      context.CancelFunc
+	rateChange  chan struct{}
+	waiter      sync.WaitGroup
+	options     json.RawMessage
+	started     bool
+	configured  bool
+}
+
+func newRunner(in Input) *runner {
+	return &runner{
+		input:      in,
+		name:       in.Name(),
+		rateChange: make(chan struct{}, 1),
+		state:      stateDisabled,
+	}
+}
+
+func (r *runner) start(strm *stream.Stream) {
+	if r.started {
+		return
+	}
+	r.started = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.setState(stateRunning)
+
+	r.waiter.Add(1)
+	go r.supervise(ctx, strm)
+
+	if r.input.Rate() > 0 {
+		r.waiter.Add(1)
+		go r.schedule(ctx)
+	}
+}
+
+func (r *runner) stop() {
+	if !r.started {
+		return
+	}
+	r.started = false
+
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+
+	err := r.input.Stop()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"input": r.name,
+			"error": err,
+		}).Error("input: Input shutdown error")
+	}
+
+	r.waiter.Wait()
+
+	r.setState(stateDisabled)
+}
+
+func (r *runner) supervise(ctx context.Context, strm *stream.Stream) {
+	defer r.waiter.Done()
+
+	backoff := &utils.Backoff{
+		Min: restartBackoffMin,
+		Max: restartBackoffMax,
+	}
+
+	for {
+		start := time.Now()
+
+		_, err := r.protect(func() error {
+			return r.input.Start(ctx, strm)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			return
+		}
+
+		if time.Since(start) > restartBackoffMax {
+			backoff.Reset()
+		}
+
+		r.recordError(err)
+		r.setState(stateFailed)
+
+		delay := backoff.Next()
+
+		logrus.WithFields(logrus.Fields{
+			"input": r.name,
+			"retry": delay.String(),
+			"error": err,
+		}).Error("input: Input failed, restarting")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		r.recordRestart()
+		r.setState(stateRunning)
+	}
+}
@@ -0,0 +1,201 @@
+package input
+
+import (
+	"context"
+	mathrand "math/rand"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	handlerTimeout = 30 * time.Second
+)
+
+func (r *runner) getRate() time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.rate
+}
+
+func (r *runner) setRate(rate time.Duration) {
+	r.lock.Lock()
+	r.rate = rate
+	r.lock.Unlock()
+
+	select {
+	case r.rateChange <- struct{}{}:
+	default:
+	}
+}
+
+func (r *runner) isRunning() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.running
+}
+
+func (r *runner) setRunning(running bool) {
+	r.lock.Lock()
+	r.running = running
+	r.lock.Unlock()
+}
+
+func (r *runner) addMissed(count int64) (total int64) {
+	r.lock.Lock()
+	r.missed += count
+	total = r.missed
+	r.lock.Unlock()
+	return
+}
+
+func (r *runner) getTimeout(rate time.Duration) (timeout time.Duration) {
+	timeout = handlerTimeout
+	if timeout > rate {
+		timeout = rate
+	}
+	return
+}
+
+type collectResult struct {
+	err      error
+	panicked bool
+}
+
+func (r *runner) collect(runCtx context.Context, timeout time.Duration) (
+	panicked bool) {
+
+	ctx, cancel := context.WithTimeout(runCtx, timeout)
+	defer cancel()
+
+	done := make(chan *collectResult, 1)
+
+	r.setRunning(true)
+	go func() {
+		defer r.setRunning(false)
+		panicked, err := r.protect(func() error {
+			return r.input.Collect(ctx)
+		})
+		done <- &collectResult{
+			err:      err,
+			panicked: panicked,
+		}
+	}()
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			r.recordError(res.err)
+			panicked = res.panicked
+
+			if !panicked {
+				logrus.WithFields(logrus.Fields{
+					"input": r.name,
+					"error": res.err,
+				}).Error("input: Input handler error")
+			}
+		} else {
+			r.recordSuccess()
+		}
+	case <-ctx.Done():
+		if runCtx.Err() != nil {
+			return
+		}
+
+		err := &errortypes.TimeoutError{
+			errors.Wrap(ctx.Err(), "input: Input handler timed out"),
+		}
+		r.recordError(err)
+
+		logrus.WithFields(logrus.Fields{
+			"input":   r.name,
+			"timeout": timeout.String(),
+			"error":   err,
+		}).Error("input: Input handler timeout")
+	}
+
+	return
+}
+
+func (r *runner) schedule(ctx context.Context) {
+	defer r.waiter.Done()
+
+	backoff := &utils.Backoff{
+		Min: restartBackoffMin,
+		Max: restartBackoffMax,
+	}
+
+	rate := r.getRate()
+	last := time.Now()
+	next := last.Add(time.Duration(mathrand.Int63n(int64(rate))))
+
+	for {
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.rateChange:
+			timer.Stop()
+			rate = r.getRate()
+			next = last.Add(rate)
+			continue
+		case <-timer.C:
+		}
+
+		rate = r.getRate()
+		last = next
+
+		if r.isRunning() {
+			missed := r.addMissed(1)
+
+			logrus.WithFields(logrus.Fields{
+				"input":  r.name,
+				"missed": missed,
+			}).Warn("input: Input handler still running, skipping")
+		} else if r.collect(ctx, r.getTimeout(rate)) {
+			r.setState(stateFailed)
+
+			delay := backoff.Next()
+
+			logrus.WithFields(logrus.Fields{
+				"input": r.name,
+				"retry": delay.String(),
+			}).Error("input: Input handler panic, restarting")
+
+			timer.Reset(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			r.recordRestart()
+			next = time.Now()
+			last = next
+			continue
+		} else {
+			backoff.Reset()
+		}
+
+		next = next.Add(rate)
+
+		now := time.Now()
+		if next.Before(now) {
+			count := int64(now.Sub(next)/rate) + 1
+			missed := r.addMissed(count)
+			next = next.Add(time.Duration(count) * rate)
+
+			logrus.WithFields(logrus.Fields{
+				"input":  r.name,
+				"count":  count,
+				"missed": missed,
+			}).Warn("input: Input missed scheduled collections")
+		}
+	}
+}
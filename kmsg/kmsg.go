@@ -1,10 +1,12 @@
 package kmsg
 
 import (
+	"context"
 	"io"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -16,8 +18,10 @@ import (
 )
 
 type reader struct {
-	stream   *stream.Stream
+	input.Base
 	boottime time.Time
+	lock     sync.Mutex
+	file     *os.File
 }
 
 func (r *reader) Handle(msgRaw string) (err error) {
@@ -66,12 +70,12 @@ func (r *reader) Handle(msgRaw string) (err error) {
 
 	doc.Boot = r.boottime.Unix()
 
-	r.stream.Append(doc)
+	r.Stream.Append(doc)
 
 	return
 }
 
-func (r *reader) Read() (err error) {
+func (r *reader) Read(ctx context.Context) (err error) {
 	file, err := os.Open("/dev/kmsg")
 	if err != nil {
 		err = &errortypes.ReadError{
@@ -83,6 +87,20 @@ func (r *reader) Read() (err error) {
 		_ = file.Close()
 	}()
 
+	r.lock.Lock()
+	if ctx.Err() != nil {
+		r.lock.Unlock()
+		return
+	}
+	r.file = file
+	r.lock.Unlock()
+
+	defer func() {
+		r.lock.Lock()
+		r.file = nil
+		r.lock.Unlock()
+	}()
+
 	n := 0
 	buffer := make([]byte, 4096)
 
@@ -94,6 +112,11 @@ func (r *reader) Read() (err error) {
 				return
 			}
 
+			if ctx.Err() != nil {
+				err = nil
+				return
+			}
+
 			err = &errortypes.ReadError{
 				errors.Wrap(err, "kmsg: Failed to read kmsg"),
 			}
@@ -110,42 +133,60 @@ func (r *reader) Read() (err error) {
 	}
 }
 
-func (r *reader) Run(strm *stream.Stream) {
-	var err error
-
-	r.stream = strm
-
+func (r *reader) Run(ctx context.Context) (err error) {
 	r.boottime, err = GetBoottime()
 	if err != nil {
-		panic(err)
+		return
 	}
 
 	for {
-		err = r.Read()
+		err = r.Read(ctx)
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
 				"error": err,
 			}).Error("kmsg: Input handler error")
 		}
 
-		time.Sleep(5 * time.Second)
+		select {
+		case <-ctx.Done():
+			err = nil
+			return
+		case <-time.After(5 * time.Second):
+		}
 	}
+}
 
-	return
+func (r *reader) Name() string {
+	return Type
 }
 
-func startup(stream *stream.Stream) (err error) {
-	readr := &reader{}
-	go readr.Run(stream)
+func (r *reader) Start(ctx context.Context, strm *stream.Stream) (
+	err error) {
+
+	r.Stream = strm
+
+	err = r.Run(ctx)
+	if err != nil {
+		return
+	}
 
 	return
 }
 
-func Register() {
-	in := &input.Input{
-		Name:    Type,
-		Startup: startup,
+func (r *reader) Stop() (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.file != nil {
+		_ = r.file.Close()
 	}
 
-	input.Register(in)
+	return
+}
+
+func Register() {
+	stream.RegisterDoc(Type, func() stream.Doc {
+		return &Kmsg{}
+	})
+	input.Register(&reader{})
 }
@@ -20,7 +20,7 @@ func GetBoottime() (boottime time.Time, err error) {
 		strings.TrimSpace(output),
 	)
 	if err != nil {
-		err = errortypes.ReadError{
+		err = &errortypes.ReadError{
 			errors.Wrap(err, "kmsg: Failed to parse boottime"),
 		}
 		return
@@ -1,6 +1,7 @@
 package load
 
 import (
+	"context"
 	"time"
 
 	"github.com/dropbox/godropbox/errors"
@@ -10,8 +11,8 @@ import (
 	"github.com/shirou/gopsutil/v3/load"
 )
 
-func Handler(stream *stream.Stream) (err error) {
-	avgStat, err := load.Avg()
+func Handler(ctx context.Context, stream *stream.Stream) (err error) {
+	avgStat, err := load.AvgWithContext(ctx)
 	if err != nil {
 		err = &errortypes.ParseError{
 			errors.Wrap(err, "load: Failed to get load average"),
@@ -30,12 +31,25 @@ func Handler(stream *stream.Stream) (err error) {
 	return
 }
 
-func Register() {
-	in := &input.Input{
-		Name:    Type,
-		Rate:    60 * time.Second,
-		Handler: Handler,
-	}
+type Input struct {
+	input.Base
+}
+
+func (i *Input) Name() string {
+	return Type
+}
 
-	input.Register(in)
+func (i *Input) Rate() time.Duration {
+	return 60 * time.Second
+}
+
+func (i *Input) Collect(ctx context.Context) error {
+	return Handler(ctx, i.Stream)
+}
+
+func Register() {
+	stream.RegisterDoc(Type, func() stream.Doc {
+		return &Load{}
+	})
+	input.Register(&Input{})
 }
@@ -3,8 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/pritunl/pritunl-endpoint/agent"
 	"github.com/pritunl/pritunl-endpoint/check"
 	"github.com/pritunl/pritunl-endpoint/config"
 	"github.com/pritunl/pritunl-endpoint/constants"
@@ -15,8 +19,12 @@ import (
 	"github.com/pritunl/pritunl-endpoint/kmsg"
 	"github.com/pritunl/pritunl-endpoint/load"
 	"github.com/pritunl/pritunl-endpoint/logger"
+	"github.com/pritunl/pritunl-endpoint/metrics"
 	"github.com/pritunl/pritunl-endpoint/network"
+	"github.com/pritunl/pritunl-endpoint/output"
+	"github.com/pritunl/pritunl-endpoint/stream"
 	"github.com/pritunl/pritunl-endpoint/system"
+	"github.com/sirupsen/logrus"
 )
 
 const help = `
@@ -51,6 +59,8 @@ func main() {
 			panic(err)
 		}
 
+		endpoint.StartCertificateRenew()
+
 		system.Register()
 		load.Register()
 		disk.Register()
@@ -58,8 +68,30 @@ func main() {
 		network.Register()
 		kmsg.Register()
 		check.Register()
+		agent.Register()
+
+		strm := stream.New()
+
+		err = metrics.Start(strm)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("main: Failed to start metrics server")
+		}
+
+		output.Start(strm)
+
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-sig
+			input.Stop()
+		}()
+
+		input.Run(strm)
 
-		input.Run()
+		output.Stop()
+		metrics.Stop()
 
 		return
 	case "version":
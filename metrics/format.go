@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+var labelEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+func writeSample(buf *bytes.Buffer, sample *Sample) {
+	buf.WriteString(sample.Name)
+	if sample.Counter {
+		buf.WriteString("_total")
+	}
+
+	if len(sample.Labels) > 0 {
+		buf.WriteByte('{')
+		for i, label := range sample.Labels {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString(nameReg.ReplaceAllString(label.Name, "_"))
+			buf.WriteString(`="`)
+			buf.WriteString(labelEscaper.Replace(label.Value))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte('}')
+	}
+
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatFloat(sample.Value, 'g', -1, 64))
+	buf.WriteByte('\n')
+}
+
+func Write(w io.Writer, samples []*Sample) (err error) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Name < samples[j].Name
+	})
+
+	buf := &bytes.Buffer{}
+	name := ""
+
+	for _, sample := range samples {
+		if sample.Name != name {
+			name = sample.Name
+
+			typ := "gauge"
+			if sample.Counter {
+				typ = "counter"
+			}
+
+			buf.WriteString("# TYPE " + name + " " + typ + "\n")
+		}
+
+		writeSample(buf, sample)
+	}
+
+	buf.WriteString("# EOF\n")
+
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "metrics: Failed to write metrics"),
+		}
+		return
+	}
+
+	return
+}
@@ -0,0 +1,229 @@
+package metrics
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pritunl/pritunl-endpoint/input"
+	"github.com/pritunl/pritunl-endpoint/kmsg"
+	"github.com/pritunl/pritunl-endpoint/stream"
+)
+
+const (
+	prefix = "pritunl_endpoint"
+)
+
+var (
+	lock        sync.Mutex
+	groups      = map[string][]*Sample{}
+	timeType    = reflect.TypeOf(time.Time{})
+	nameReg     = regexp.MustCompile("[^a-zA-Z0-9_]")
+	camelReg    = regexp.MustCompile("([a-z0-9])([A-Z])")
+	acronymReg  = regexp.MustCompile("([A-Z]+)([A-Z][a-z])")
+	fieldsCache = sync.Map{}
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Name    string
+	Labels  []*Label
+	Value   float64
+	Counter bool
+}
+
+type Exporter interface {
+	Samples() (group string, samples []*Sample)
+}
+
+func MetricName(parts ...string) string {
+	name := strings.Join(append([]string{prefix}, parts...), "_")
+	return nameReg.ReplaceAllString(name, "_")
+}
+
+func snakeCase(name string) string {
+	name = acronymReg.ReplaceAllString(name, "${1}_${2}")
+	name = camelReg.ReplaceAllString(name, "${1}_${2}")
+	return strings.ToLower(name)
+}
+
+func getValue(val reflect.Value) (value float64, ok bool) {
+	switch val.Kind() {
+	case reflect.Bool:
+		if val.Bool() {
+			value = 1
+		}
+		ok = true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+
+		value = float64(val.Int())
+		ok = true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+
+		value = float64(val.Uint())
+		ok = true
+	case reflect.Float32, reflect.Float64:
+		value = val.Float()
+		ok = true
+	case reflect.Struct:
+		if val.Type() == timeType {
+			timestamp := val.Interface().(time.Time)
+			if !timestamp.IsZero() {
+				value = float64(timestamp.Unix())
+			}
+			ok = true
+		}
+	}
+
+	return
+}
+
+func indirect(val reflect.Value) (reflect.Value, bool) {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return val, false
+		}
+		val = val.Elem()
+	}
+	return val, true
+}
+
+type field struct {
+	index int
+	name  string
+}
+
+func getFields(typ reflect.Type) (fields []*field) {
+	cached, ok := fieldsCache.Load(typ)
+	if ok {
+		return cached.([]*field)
+	}
+
+	fields = []*field{}
+	for i := 0; i < typ.NumField(); i++ {
+		fld := typ.Field(i)
+		if fld.PkgPath != "" || fld.Name == "Timestamp" ||
+			fld.Tag.Get("json") == "-" {
+
+			continue
+		}
+
+		fields = append(fields, &field{
+			index: i,
+			name:  snakeCase(fld.Name),
+		})
+	}
+
+	fieldsCache.Store(typ, fields)
+
+	return
+}
+
+func collectStruct(val reflect.Value, name string, labels []*Label) (
+	samples []*Sample) {
+
+	fields := getFields(val.Type())
+	labels = append([]*Label{}, labels...)
+
+	for _, fld := range fields {
+		fieldVal, ok := indirect(val.Field(fld.index))
+		if ok && fieldVal.Kind() == reflect.String {
+			labels = append(labels, &Label{
+				Name:  fld.name,
+				Value: fieldVal.String(),
+			})
+		}
+	}
+
+	for _, fld := range fields {
+		fieldVal, ok := indirect(val.Field(fld.index))
+		if !ok {
+			continue
+		}
+
+		value, ok := getValue(fieldVal)
+		if ok {
+			samples = append(samples, &Sample{
+				Name:   MetricName(name, fld.name),
+				Labels: labels,
+				Value:  value,
+			})
+			continue
+		}
+
+		if fieldVal.Kind() != reflect.Slice {
+			continue
+		}
+
+		for i := 0; i < fieldVal.Len(); i++ {
+			elem, ok := indirect(fieldVal.Index(i))
+			if !ok || elem.Kind() != reflect.Struct ||
+				elem.Type() == timeType {
+
+				continue
+			}
+
+			samples = append(samples, collectStruct(
+				elem, name+"_"+fld.name, labels)...)
+		}
+	}
+
+	return
+}
+
+func GetSamples(doc stream.Doc) (group string, samples []*Sample) {
+	if exporter, ok := doc.(Exporter); ok {
+		group, samples = exporter.Samples()
+		return
+	}
+
+	val, ok := indirect(reflect.ValueOf(doc))
+	if !ok || val.Kind() != reflect.Struct {
+		return
+	}
+
+	samples = collectStruct(val, doc.GetType(), []*Label{})
+
+	return
+}
+
+func Update(doc stream.Doc) {
+	switch doc.GetType() {
+	case input.HealthType, kmsg.Type:
+		return
+	}
+
+	group, samples := GetSamples(doc)
+	if samples == nil {
+		return
+	}
+
+	lock.Lock()
+	groups[doc.GetType()+":"+group] = samples
+	lock.Unlock()
+}
+
+func Samples() (samples []*Sample) {
+	lock.Lock()
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		samples = append(samples, groups[key]...)
+	}
+	lock.Unlock()
+
+	return
+}
@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/input"
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultAddress = "127.0.0.1:9756"
+	contentType    = "application/openmetrics-text; version=1.0.0; " +
+		"charset=utf-8"
+)
+
+func streamSamples(strm *stream.Stream) (samples []*Sample) {
+	stats := strm.Stats()
+
+	connected := 0.0
+	if stats.Connected {
+		connected = 1
+	}
+
+	samples = []*Sample{
+		{
+			Name:  MetricName("stream", "primary"),
+			Value: float64(stats.Primary),
+		},
+		{
+			Name:  MetricName("stream", "secondary"),
+			Value: float64(stats.Secondary),
+		},
+		{
+			Name:  MetricName("stream", "unacked"),
+			Value: float64(stats.Unacked),
+		},
+		{
+			Name:  MetricName("stream", "spooled"),
+			Value: float64(stats.Spooled),
+		},
+		{
+			Name:    MetricName("stream", "sent"),
+			Value:   float64(stats.Sent),
+			Counter: true,
+		},
+		{
+			Name:    MetricName("stream", "dropped"),
+			Value:   float64(stats.Dropped),
+			Counter: true,
+		},
+		{
+			Name:    MetricName("stream", "evicted"),
+			Value:   float64(stats.Evicted),
+			Counter: true,
+		},
+		{
+			Name:    MetricName("stream", "retransmitted"),
+			Value:   float64(stats.Retransmitted),
+			Counter: true,
+		},
+		{
+			Name:    MetricName("stream", "reconnects"),
+			Value:   float64(stats.Reconnects),
+			Counter: true,
+		},
+		{
+			Name: MetricName("stream", "connected"),
+			Labels: []*Label{
+				{
+					Name:  "host",
+					Value: stats.Host,
+				},
+			},
+			Value: connected,
+		},
+	}
+
+	return
+}
+
+func healthSamples() (samples []*Sample) {
+	samples = []*Sample{}
+
+	for _, health := range input.GetHealth() {
+		labels := []*Label{
+			{
+				Name:  "input",
+				Value: health.Name,
+			},
+		}
+
+		running := 0.0
+		if health.State == "running" {
+			running = 1
+		}
+
+		lastSuccess := 0.0
+		if !health.LastSuccess.IsZero() {
+			lastSuccess = float64(health.LastSuccess.Unix())
+		}
+
+		samples = append(samples,
+			&Sample{
+				Name:   MetricName("input", "running"),
+				Labels: labels,
+				Value:  running,
+			},
+			&Sample{
+				Name:    MetricName("input", "panics"),
+				Labels:  labels,
+				Value:   float64(health.Panics),
+				Counter: true,
+			},
+			&Sample{
+				Name:    MetricName("input", "errors"),
+				Labels:  labels,
+				Value:   float64(health.Errors),
+				Counter: true,
+			},
+			&Sample{
+				Name:    MetricName("input", "restarts"),
+				Labels:  labels,
+				Value:   float64(health.Restarts),
+				Counter: true,
+			},
+			&Sample{
+				Name:    MetricName("input", "missed"),
+				Labels:  labels,
+				Value:   float64(health.Missed),
+				Counter: true,
+			},
+			&Sample{
+				Name:   MetricName("input", "last_success"),
+				Labels: labels,
+				Value:  lastSuccess,
+			},
+		)
+	}
+
+	return
+}
+
+var (
+	server     *http.Server
+	serverLock sync.Mutex
+)
+
+func handle(strm *stream.Stream) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		samples := append(Samples(), streamSamples(strm)...)
+		samples = append(samples, healthSamples()...)
+
+		w.Header().Set("Content-Type", contentType)
+		err := Write(w, samples)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("metrics: Failed to write metrics")
+		}
+	}
+}
+
+func Start(strm *stream.Stream) (err error) {
+	conf := config.Config.Metrics
+	if !conf.Enabled {
+		return
+	}
+
+	addr := conf.Address
+	if addr == "" {
+		addr = DefaultAddress
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "metrics: Failed to listen on metrics address"),
+		}
+		return
+	}
+
+	strm.Observe(Update)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handle(strm))
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+
+	serverLock.Lock()
+	server = srv
+	serverLock.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"address": addr,
+	}).Info("metrics: Starting metrics server")
+
+	go func() {
+		e := srv.Serve(listener)
+		if e != nil && e != http.ErrServerClosed {
+			logrus.WithFields(logrus.Fields{
+				"error": e,
+			}).Error("metrics: Metrics server error")
+		}
+	}()
+
+	return
+}
+
+func Stop() {
+	serverLock.Lock()
+	srv := server
+	server = nil
+	serverLock.Unlock()
+
+	if srv == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_ = srv.Shutdown(ctx)
+}
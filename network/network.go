@@ -1,6 +1,7 @@
 package network
 
 import (
+	"context"
 	"time"
 
 	"github.com/dropbox/godropbox/errors"
@@ -14,8 +15,8 @@ var (
 	prev map[string]net.IOCountersStat
 )
 
-func Handler(stream *stream.Stream) (err error) {
-	stats, err := net.IOCounters(true)
+func Handler(ctx context.Context, stream *stream.Stream) (err error) {
+	stats, err := net.IOCountersWithContext(ctx, true)
 	if err != nil {
 		err = &errortypes.ParseError{
 			errors.Wrap(err, "network: Failed to get network average"),
@@ -74,12 +75,25 @@ func Handler(stream *stream.Stream) (err error) {
 	return
 }
 
-func Register() {
-	in := &input.Input{
-		Name:    Type,
-		Rate:    60 * time.Second,
-		Handler: Handler,
-	}
+type Input struct {
+	input.Base
+}
+
+func (i *Input) Name() string {
+	return Type
+}
 
-	input.Register(in)
+func (i *Input) Rate() time.Duration {
+	return 60 * time.Second
+}
+
+func (i *Input) Collect(ctx context.Context) error {
+	return Handler(ctx, i.Stream)
+}
+
+func Register() {
+	stream.RegisterDoc(Type, func() stream.Doc {
+		return &Network{}
+	})
+	input.Register(&Input{})
 }
@@ -1,21 +1,136 @@
 package nonce
 
 import (
-	"github.com/dropbox/godropbox/container/set"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
 	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/constants"
 	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	Window   = 300 * time.Second
+	fileName = "nonces.json"
 )
 
-var nonces = set.NewSet()
+var (
+	lock   sync.Mutex
+	loaded = false
+	nonces = map[string]int64{}
+)
+
+func getPath() string {
+	return filepath.Join(constants.VarDir, fileName)
+}
+
+func load() {
+	loaded = true
+
+	data, err := ioutil.ReadFile(getPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("nonce: Failed to read nonce cache")
+		}
+		return
+	}
+
+	cache := map[string]int64{}
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("nonce: Failed to parse nonce cache")
+		return
+	}
+
+	nonces = cache
+}
+
+func save() (err error) {
+	data, err := json.Marshal(nonces)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "nonce: Failed to marshal nonce cache"),
+		}
+		return
+	}
 
-func Validate(nce string) (err error) {
-	if nonces.Contains(nce) {
+	err = utils.ExistsMkdir(constants.VarDir, 0700)
+	if err != nil {
+		return
+	}
+
+	pth := getPath()
+	tmpPth := pth + ".tmp"
+
+	err = ioutil.WriteFile(tmpPth, data, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "nonce: Failed to write nonce cache"),
+		}
+		return
+	}
+
+	err = os.Rename(tmpPth, pth)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "nonce: Failed to write nonce cache"),
+		}
+		return
+	}
+
+	return
+}
+
+func expire() {
+	for nce, timestamp := range nonces {
+		if utils.SinceAbs(time.Unix(timestamp, 0)) > Window {
+			delete(nonces, nce)
+		}
+	}
+}
+
+func ValidateTimestamp(nce string, timestamp time.Time) (err error) {
+	if utils.SinceAbs(timestamp) > Window {
+		err = &errortypes.AuthenticationError{
+			errors.New("nonce: Authentication timestamp outside window"),
+		}
+		return
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if !loaded {
+		load()
+	}
+
+	expire()
+
+	if _, ok := nonces[nce]; ok {
 		err = &errortypes.AuthenticationError{
 			errors.New("nonce: Duplicate authentication nonce"),
 		}
+		return
 	}
 
-	nonces.Add(nce)
+	nonces[nce] = timestamp.Unix()
+
+	e := save()
+	if e != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": e,
+		}).Error("nonce: Failed to save nonce cache")
+	}
 
 	return
 }
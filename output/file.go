@@ -0,0 +1,111 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/constants"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+type fileSink struct {
+	path string
+	file *os.File
+}
+
+func newFileSink(conf *config.Output) (sink *fileSink, err error) {
+	path := conf.Path
+	if path == "" {
+		path = filepath.Join(constants.VarDir, "output.jsonl")
+	}
+
+	sink = &fileSink{
+		path: path,
+	}
+
+	return
+}
+
+func (s *fileSink) open() (err error) {
+	if s.file != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "output: Failed to create output directory"),
+		}
+		return
+	}
+
+	file, err := os.OpenFile(s.path,
+		os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "output: Failed to open output file"),
+		}
+		return
+	}
+
+	s.file = file
+
+	return
+}
+
+func (s *fileSink) Write(ctx context.Context, records []*Record) (
+	err error) {
+
+	err = s.open()
+	if err != nil {
+		return
+	}
+
+	writer := bufio.NewWriter(s.file)
+	encoder := json.NewEncoder(writer)
+
+	for _, rec := range records {
+		err = encoder.Encode(rec)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "output: Failed to encode output record"),
+			}
+			return
+		}
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		_ = s.file.Close()
+		s.file = nil
+
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "output: Failed to write output file"),
+		}
+		return
+	}
+
+	return
+}
+
+func (s *fileSink) Close() (err error) {
+	if s.file == nil {
+		return
+	}
+
+	err = s.file.Close()
+	s.file = nil
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "output: Failed to close output file"),
+		}
+		return
+	}
+
+	return
+}
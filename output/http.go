@@ -0,0 +1,110 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/constants"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+type httpSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHttpSink(rawUrl string, headers map[string]string) (
+	sink *httpSink, err error) {
+
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "output: Failed to parse output URL"),
+		}
+		return
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		err = &errortypes.ParseError{
+			errors.Newf("output: Invalid output URL '%s'", rawUrl),
+		}
+		return
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   defaultTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	sink = &httpSink{
+		url:     u.String(),
+		headers: headers,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         dialer.DialContext,
+				ForceAttemptHTTP2:   true,
+				MaxIdleConns:        4,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: defaultTimeout,
+			},
+		},
+	}
+
+	return
+}
+
+func (s *httpSink) post(ctx context.Context, contentType string,
+	data []byte) (err error) {
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		"POST",
+		s.url,
+		bytes.NewReader(data),
+	)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "output: Request create error"),
+		}
+		return
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "pritunl-endpoint/"+constants.Version)
+	for key, val := range s.headers {
+		req.Header.Set(key, val)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "output: Request error"),
+		}
+		return
+	}
+	defer res.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		err = &errortypes.RequestError{
+			errors.Newf("output: Bad response status %d", res.StatusCode),
+		}
+		return
+	}
+
+	return
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,146 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/constants"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string     `json:"key"`
+	Value *otlpValue `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano   string           `json:"timeUnixNano"`
+	SeverityNumber int              `json:"severityNumber"`
+	SeverityText   string           `json:"severityText"`
+	Body           *otlpValue       `json:"body"`
+	Attributes     []*otlpAttribute `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpScopeLogs struct {
+	Scope      *otlpScope       `json:"scope"`
+	LogRecords []*otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResource struct {
+	Attributes []*otlpAttribute `json:"attributes"`
+}
+
+type otlpResourceLogs struct {
+	Resource  *otlpResource    `json:"resource"`
+	ScopeLogs []*otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpLogs struct {
+	ResourceLogs []*otlpResourceLogs `json:"resourceLogs"`
+}
+
+type otlpSink struct {
+	*httpSink
+}
+
+func newOtlpSink(conf *config.Output) (sink *otlpSink, err error) {
+	httpSink, err := newHttpSink(conf.Url, conf.Headers)
+	if err != nil {
+		return
+	}
+
+	sink = &otlpSink{
+		httpSink: httpSink,
+	}
+
+	return
+}
+
+func (s *otlpSink) Write(ctx context.Context, records []*Record) (
+	err error) {
+
+	logRecords := []*otlpLogRecord{}
+	for _, rec := range records {
+		logRecords = append(logRecords, &otlpLogRecord{
+			TimeUnixNano:   strconv.FormatInt(rec.Timestamp.UnixNano(), 10),
+			SeverityNumber: 9,
+			SeverityText:   "INFO",
+			Body: &otlpValue{
+				StringValue: string(rec.Data),
+			},
+			Attributes: []*otlpAttribute{
+				{
+					Key: "doc.type",
+					Value: &otlpValue{
+						StringValue: rec.Type,
+					},
+				},
+			},
+		})
+	}
+
+	logs := &otlpLogs{
+		ResourceLogs: []*otlpResourceLogs{
+			{
+				Resource: &otlpResource{
+					Attributes: []*otlpAttribute{
+						{
+							Key: "service.name",
+							Value: &otlpValue{
+								StringValue: "pritunl-endpoint",
+							},
+						},
+						{
+							Key: "service.version",
+							Value: &otlpValue{
+								StringValue: constants.Version,
+							},
+						},
+						{
+							Key: "service.instance.id",
+							Value: &otlpValue{
+								StringValue: config.Config.Id,
+							},
+						},
+					},
+				},
+				ScopeLogs: []*otlpScopeLogs{
+					{
+						Scope: &otlpScope{
+							Name:    "pritunl-endpoint",
+							Version: constants.Version,
+						},
+						LogRecords: logRecords,
+					},
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(logs)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "output: Failed to marshal otlp data"),
+		}
+		return
+	}
+
+	err = s.post(ctx, "application/json", data)
+	if err != nil {
+		return
+	}
+
+	return
+}
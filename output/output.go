@@ -0,0 +1,242 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/dropbox/godropbox/container/set"
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBufferSize = 10000
+	defaultBatchSize  = 100
+	defaultTimeout    = 10 * time.Second
+	flushInterval     = 1 * time.Second
+	flushTimeout      = 5 * time.Second
+	retryBackoffMin   = 1 * time.Second
+	retryBackoffMax   = 1 * time.Minute
+)
+
+type Record struct {
+	Type      string          `json:"type"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type Sink interface {
+	Write(ctx context.Context, records []*Record) error
+	Close() error
+}
+
+type output struct {
+	name      string
+	sink      Sink
+	types     set.Set
+	buffer    chan *Record
+	batchSize int
+	timeout   time.Duration
+	dropped   uint64
+}
+
+func newSink(conf *config.Output) (sink Sink, err error) {
+	switch conf.Type {
+	case "file":
+		sink, err = newFileSink(conf)
+	case "stdout":
+		sink = newStdoutSink()
+	case "syslog":
+		sink, err = newSyslogSink(conf)
+	case "otlp":
+		sink, err = newOtlpSink(conf)
+	case "webhook":
+		sink, err = newWebhookSink(conf)
+	default:
+		err = &errortypes.ParseError{
+			errors.Newf("output: Unknown output type '%s'", conf.Type),
+		}
+	}
+
+	return
+}
+
+func newOutput(conf *config.Output) (out *output, err error) {
+	sink, err := newSink(conf)
+	if err != nil {
+		return
+	}
+
+	out = &output{
+		name:      conf.Type,
+		sink:      sink,
+		buffer:    make(chan *Record, defaultBufferSize),
+		batchSize: defaultBatchSize,
+		timeout:   defaultTimeout,
+	}
+
+	if conf.BufferSize > 0 {
+		out.buffer = make(chan *Record, conf.BufferSize)
+	}
+	if conf.BatchSize > 0 {
+		out.batchSize = conf.BatchSize
+	}
+	if conf.Timeout > 0 {
+		out.timeout = time.Duration(conf.Timeout) * time.Second
+	}
+
+	if len(conf.Types) > 0 {
+		out.types = set.NewSet()
+		for _, typ := range conf.Types {
+			out.types.Add(typ)
+		}
+	}
+
+	return
+}
+
+func (o *output) accepts(doc stream.Doc) bool {
+	return o.types == nil || o.types.Contains(doc.GetType())
+}
+
+func (o *output) push(rec *Record) {
+	select {
+	case o.buffer <- rec:
+	default:
+		dropped := atomic.AddUint64(&o.dropped, 1)
+		if dropped%1000 == 1 {
+			logrus.WithFields(logrus.Fields{
+				"output":  o.name,
+				"dropped": dropped,
+			}).Warn("output: Output buffer full, dropping docs")
+		}
+	}
+}
+
+func (o *output) write(ctx context.Context, records []*Record) (
+	err error) {
+
+	writeCtx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	err = o.sink.Write(writeCtx, records)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (o *output) deliver(ctx context.Context, records []*Record) (
+	ok bool) {
+
+	backoff := &utils.Backoff{
+		Min: retryBackoffMin,
+		Max: retryBackoffMax,
+	}
+
+	for {
+		err := o.write(ctx, records)
+		if err == nil {
+			ok = true
+			return
+		}
+
+		delay := backoff.Next()
+
+		logrus.WithFields(logrus.Fields{
+			"output": o.name,
+			"count":  len(records),
+			"retry":  delay.String(),
+			"error":  err,
+		}).Error("output: Output write failed")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (o *output) collect(records []*Record) []*Record {
+	for len(records) < o.batchSize {
+		select {
+		case rec := <-o.buffer:
+			records = append(records, rec)
+		default:
+			return records
+		}
+	}
+
+	return records
+}
+
+func (o *output) flush(records []*Record) {
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+
+	for ctx.Err() == nil {
+		records = o.collect(records)
+		if len(records) == 0 {
+			return
+		}
+
+		err := o.write(ctx, records)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"output": o.name,
+				"count":  len(records),
+				"error":  err,
+			}).Error("output: Output flush failed")
+			return
+		}
+
+		records = nil
+	}
+}
+
+func (o *output) run(ctx context.Context) {
+	defer func() {
+		err := o.sink.Close()
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"output": o.name,
+				"error":  err,
+			}).Error("output: Failed to close output")
+		}
+	}()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		var records []*Record
+
+		select {
+		case <-ctx.Done():
+			o.flush(nil)
+			return
+		case rec := <-o.buffer:
+			records = o.collect([]*Record{rec})
+			if len(records) < o.batchSize {
+				select {
+				case <-ctx.Done():
+				case <-ticker.C:
+				}
+				records = o.collect(records)
+			}
+		}
+
+		if ctx.Err() != nil || !o.deliver(ctx, records) {
+			o.flush(records)
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/stream"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	lock    sync.RWMutex
+	outputs []*output
+	cancel  context.CancelFunc
+	waiter  = &sync.WaitGroup{}
+)
+
+func getOutputs() (outs []*output) {
+	lock.RLock()
+	outs = outputs
+	lock.RUnlock()
+	return
+}
+
+func handle(doc stream.Doc) {
+	var rec *Record
+
+	for _, out := range getOutputs() {
+		if !out.accepts(doc) {
+			continue
+		}
+
+		if rec == nil {
+			data, err := json.Marshal(doc)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"type":  doc.GetType(),
+					"error": err,
+				}).Error("output: Failed to marshal doc")
+				return
+			}
+
+			rec = &Record{
+				Type:      doc.GetType(),
+				Timestamp: doc.GetTimestamp(),
+				Data:      data,
+			}
+		}
+
+		out.push(rec)
+	}
+}
+
+func Start(strm *stream.Stream) {
+	outs := []*output{}
+	for _, conf := range config.Config.Outputs {
+		if conf == nil {
+			continue
+		}
+
+		out, err := newOutput(conf)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"type":  conf.Type,
+				"error": err,
+			}).Error("output: Failed to create output")
+			continue
+		}
+
+		outs = append(outs, out)
+	}
+
+	if len(outs) == 0 {
+		return
+	}
+
+	ctx, cancelFunc := context.WithCancel(context.Background())
+
+	for _, out := range outs {
+		waiter.Add(1)
+		go func(out *output) {
+			defer waiter.Done()
+			out.run(ctx)
+		}(out)
+	}
+
+	lock.Lock()
+	outputs = outs
+	cancel = cancelFunc
+	lock.Unlock()
+
+	strm.Observe(handle)
+}
+
+func Stop() {
+	lock.Lock()
+	cancelFunc := cancel
+	outputs = nil
+	cancel = nil
+	lock.Unlock()
+
+	if cancelFunc == nil {
+		return
+	}
+
+	cancelFunc()
+	waiter.Wait()
+}
@@ -0,0 +1,48 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+type stdoutSink struct{}
+
+func newStdoutSink() *stdoutSink {
+	return &stdoutSink{}
+}
+
+func (s *stdoutSink) Write(ctx context.Context, records []*Record) (
+	err error) {
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+
+	for _, rec := range records {
+		err = encoder.Encode(rec)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "output: Failed to encode output record"),
+			}
+			return
+		}
+	}
+
+	_, err = os.Stdout.Write(buf.Bytes())
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "output: Failed to write stdout"),
+		}
+		return
+	}
+
+	return
+}
+
+func (s *stdoutSink) Close() error {
+	return nil
+}
@@ -0,0 +1,148 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+const (
+	syslogPriority = 16*8 + 6
+	syslogTag      = "pritunl-endpoint"
+)
+
+type syslogSink struct {
+	network  string
+	address  string
+	tag      string
+	hostname string
+	conn     net.Conn
+}
+
+func newSyslogSink(conf *config.Output) (sink *syslogSink, err error) {
+	if conf.Address == "" {
+		err = &errortypes.ParseError{
+			errors.New("output: Syslog output missing address"),
+		}
+		return
+	}
+
+	sink = &syslogSink{
+		network: conf.Network,
+		address: conf.Address,
+		tag:     conf.Tag,
+	}
+
+	switch sink.network {
+	case "":
+		sink.network = "udp"
+	case "udp", "tcp":
+		break
+	default:
+		err = &errortypes.ParseError{
+			errors.Newf("output: Unknown syslog network '%s'", conf.Network),
+		}
+		return
+	}
+
+	if sink.tag == "" {
+		sink.tag = syslogTag
+	}
+
+	sink.hostname, _ = os.Hostname()
+	if sink.hostname == "" {
+		sink.hostname = "-"
+	}
+
+	return
+}
+
+func (s *syslogSink) format(rec *Record) []byte {
+	buf := &bytes.Buffer{}
+
+	buf.WriteString("<" + strconv.Itoa(syslogPriority) + ">1 ")
+	buf.WriteString(rec.Timestamp.UTC().Format(time.RFC3339Nano) + " ")
+	buf.WriteString(s.hostname + " ")
+	buf.WriteString(s.tag + " ")
+	buf.WriteString(strconv.Itoa(os.Getpid()) + " ")
+	buf.WriteString(rec.Type + " - ")
+	buf.Write(rec.Data)
+
+	if s.network == "tcp" {
+		return append([]byte(strconv.Itoa(buf.Len())+" "), buf.Bytes()...)
+	}
+
+	return buf.Bytes()
+}
+
+func (s *syslogSink) connect(ctx context.Context) (err error) {
+	if s.conn != nil {
+		return
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, s.network, s.address)
+	if err != nil {
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "output: Failed to connect to syslog"),
+		}
+		return
+	}
+
+	s.conn = conn
+
+	return
+}
+
+func (s *syslogSink) Write(ctx context.Context, records []*Record) (
+	err error) {
+
+	err = s.connect(ctx)
+	if err != nil {
+		return
+	}
+
+	deadline, ok := ctx.Deadline()
+	if ok {
+		_ = s.conn.SetWriteDeadline(deadline)
+	}
+
+	for _, rec := range records {
+		_, err = s.conn.Write(s.format(rec))
+		if err != nil {
+			_ = s.conn.Close()
+			s.conn = nil
+
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "output: Failed to write syslog"),
+			}
+			return
+		}
+	}
+
+	return
+}
+
+func (s *syslogSink) Close() (err error) {
+	if s.conn == nil {
+		return
+	}
+
+	err = s.conn.Close()
+	s.conn = nil
+	if err != nil {
+		err = &errortypes.ConnectionError{
+			errors.Wrap(err, "output: Failed to close syslog connection"),
+		}
+		return
+	}
+
+	return
+}
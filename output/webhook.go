@@ -0,0 +1,46 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+type webhookSink struct {
+	*httpSink
+}
+
+func newWebhookSink(conf *config.Output) (sink *webhookSink, err error) {
+	httpSink, err := newHttpSink(conf.Url, conf.Headers)
+	if err != nil {
+		return
+	}
+
+	sink = &webhookSink{
+		httpSink: httpSink,
+	}
+
+	return
+}
+
+func (s *webhookSink) Write(ctx context.Context, records []*Record) (
+	err error) {
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "output: Failed to marshal webhook data"),
+		}
+		return
+	}
+
+	err = s.post(ctx, "application/json", data)
+	if err != nil {
+		return
+	}
+
+	return
+}
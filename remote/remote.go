@@ -0,0 +1,135 @@
+package remote
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	backoffMin = 5 * time.Second
+	backoffMax = 5 * time.Minute
+)
+
+var (
+	lock      sync.Mutex
+	hosts     = map[string]*host{}
+	preferred = ""
+	offset    = rand.Int()
+)
+
+type host struct {
+	address     string
+	failures    int
+	retry       time.Time
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+func (h *host) healthy() bool {
+	return time.Now().After(h.retry)
+}
+
+func getHost(address string) (hst *host) {
+	hst = hosts[address]
+	if hst == nil {
+		hst = &host{
+			address: address,
+		}
+		hosts[address] = hst
+	}
+	return
+}
+
+func Hosts() (addresses []string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	remoteHosts := config.Config.RemoteHosts
+	addresses = []string{}
+	backoff := []*host{}
+
+	n := len(remoteHosts)
+	if n == 0 {
+		return
+	}
+
+	if preferred != "" {
+		for _, address := range remoteHosts {
+			if address == preferred && getHost(address).healthy() {
+				addresses = append(addresses, address)
+				break
+			}
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		address := remoteHosts[(offset+i)%n]
+		if len(addresses) > 0 && address == addresses[0] {
+			continue
+		}
+
+		hst := getHost(address)
+		if hst.healthy() {
+			addresses = append(addresses, address)
+		} else {
+			backoff = append(backoff, hst)
+		}
+	}
+
+	sort.SliceStable(backoff, func(i, j int) bool {
+		return backoff[i].retry.Before(backoff[j].retry)
+	})
+
+	for _, hst := range backoff {
+		addresses = append(addresses, hst.address)
+	}
+
+	return
+}
+
+func Success(address string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	hst := getHost(address)
+	hst.failures = 0
+	hst.retry = time.Time{}
+	hst.lastSuccess = time.Now()
+
+	if preferred != address {
+		logrus.WithFields(logrus.Fields{
+			"pritunl_zero_host": address,
+		}).Info("remote: Using remote host")
+	}
+	preferred = address
+}
+
+func Failure(address string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	hst := getHost(address)
+	hst.failures += 1
+	hst.lastFailure = time.Now()
+
+	backoff := backoffMin << uint(hst.failures-1)
+	if backoff > backoffMax || backoff <= 0 {
+		backoff = backoffMax
+	}
+	hst.retry = time.Now().Add(backoff)
+
+	if preferred == address {
+		preferred = ""
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"pritunl_zero_host": address,
+		"failures":          hst.failures,
+		"retry":             backoff.String(),
+	}).Warn("remote: Remote host failed")
+}
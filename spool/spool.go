@@ -0,0 +1,730 @@
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	segmentSize    = 4 * 1024 * 1024
+	segmentExt     = ".log"
+	ackExt         = ".ack"
+	DefaultMaxSize = 256 * 1024 * 1024
+	DefaultMaxAge  = 7 * 24 * time.Hour
+)
+
+const (
+	stateQueued byte = iota
+	stateSpilled
+	stateDone
+)
+
+type Record struct {
+	Seq       uint64          `json:"s,omitempty"`
+	Type      string          `json:"y"`
+	Timestamp time.Time       `json:"t"`
+	Data      json.RawMessage `json:"d"`
+}
+
+type Position struct {
+	seg   *segment
+	index int
+}
+
+type segment struct {
+	id       uint64
+	path     string
+	ackPath  string
+	ackFile  *os.File
+	size     int64
+	modified time.Time
+	states   []byte
+	pending  int
+	spilled  int
+	closed   bool
+	removed  bool
+}
+
+func (g *segment) writeAck(index int) (err error) {
+	if g.ackFile == nil {
+		g.ackFile, err = os.OpenFile(g.ackPath,
+			os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "spool: Failed to open segment acks"),
+			}
+			return
+		}
+	}
+
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, uint32(index))
+
+	_, err = g.ackFile.Write(data)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "spool: Failed to write segment ack"),
+		}
+		return
+	}
+
+	return
+}
+
+func (g *segment) closeAcks() {
+	if g.ackFile != nil {
+		_ = g.ackFile.Close()
+		g.ackFile = nil
+	}
+}
+
+func (g *segment) removeAcks() {
+	g.closeAcks()
+
+	err := os.Remove(g.ackPath)
+	if err != nil && !os.IsNotExist(err) {
+		logrus.WithFields(logrus.Fields{
+			"segment": g.path,
+			"error":   err,
+		}).Error("spool: Failed to remove segment acks")
+	}
+}
+
+func (g *segment) loadAcks() (err error) {
+	data, err := ioutil.ReadFile(g.ackPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "spool: Failed to read segment acks"),
+		}
+		return
+	}
+
+	for i := 0; i+4 <= len(data); i += 4 {
+		index := int(binary.BigEndian.Uint32(data[i : i+4]))
+		if index < len(g.states) {
+			g.setState(index, stateDone)
+		}
+	}
+
+	return
+}
+
+func (g *segment) setState(index int, state byte) {
+	prev := g.states[index]
+	if prev == state {
+		return
+	}
+
+	if prev == stateSpilled {
+		g.spilled -= 1
+	}
+	if state == stateSpilled {
+		g.spilled += 1
+	}
+	if state == stateDone {
+		g.pending -= 1
+	}
+
+	g.states[index] = state
+}
+
+type Spool struct {
+	lock     sync.Mutex
+	dir      string
+	maxSize  int64
+	maxAge   time.Duration
+	size     int64
+	evicted  int64
+	nextId   uint64
+	segments []*segment
+	active   *segment
+	file     *os.File
+	closed   bool
+}
+
+func (s *Spool) Write(rec *Record, spilled bool) (pos *Position, err error) {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "spool: Failed to marshal record"),
+		}
+		return
+	}
+	data = append(data, '\n')
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		err = &errortypes.WriteError{
+			errors.New("spool: Spool is closed"),
+		}
+		return
+	}
+
+	if s.active == nil || s.active.size+int64(len(data)) > s.segmentSize() {
+		err = s.roll()
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = s.file.Write(data)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "spool: Failed to write record"),
+		}
+		return
+	}
+
+	seg := s.active
+	seg.size += int64(len(data))
+	seg.modified = time.Now()
+	seg.pending += 1
+	seg.states = append(seg.states, stateQueued)
+	if spilled {
+		seg.setState(len(seg.states)-1, stateSpilled)
+	}
+	s.size += int64(len(data))
+
+	pos = &Position{
+		seg:   seg,
+		index: len(seg.states) - 1,
+	}
+
+	s.evict()
+
+	return
+}
+
+func (s *Spool) Spill(pos *Position) (spilled bool) {
+	if pos == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed || pos.seg.removed {
+		return
+	}
+
+	switch pos.seg.states[pos.index] {
+	case stateQueued:
+		pos.seg.setState(pos.index, stateSpilled)
+		spilled = true
+	case stateSpilled:
+		spilled = true
+	}
+
+	return
+}
+
+func (s *Spool) Done(pos *Position) {
+	if pos == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	seg := pos.seg
+	if s.closed || seg.removed || seg.states[pos.index] == stateDone {
+		return
+	}
+
+	s.markDone(seg, pos.index)
+
+	if seg.closed && seg.pending <= 0 {
+		s.remove(seg)
+	}
+}
+
+func (s *Spool) markDone(seg *segment, index int) {
+	seg.setState(index, stateDone)
+
+	err := seg.writeAck(index)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"segment": seg.path,
+			"error":   err,
+		}).Error("spool: Failed to persist segment ack")
+	}
+}
+
+func (s *Spool) Replay(max int,
+	handler func(rec *Record, pos *Position)) (count int, err error) {
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	for _, seg := range s.segments {
+		if count >= max {
+			break
+		}
+		if seg.spilled == 0 {
+			continue
+		}
+
+		n := 0
+		n, err = s.replaySegment(seg, max-count, handler)
+		count += n
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *Spool) replaySegment(seg *segment, max int,
+	handler func(rec *Record, pos *Position)) (count int, err error) {
+
+	file, err := os.Open(seg.path)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "spool: Failed to open segment"),
+		}
+		return
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for index := 0; index < len(seg.states) && count < max; index++ {
+		line, e := reader.ReadBytes('\n')
+		if e != nil {
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "spool: Failed to read segment"),
+			}
+			return
+		}
+
+		if seg.states[index] != stateSpilled {
+			continue
+		}
+
+		rec := &Record{}
+		e = json.Unmarshal(line, rec)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"segment": seg.path,
+				"error":   e,
+			}).Error("spool: Failed to parse record, dropping")
+			s.markDone(seg, index)
+			continue
+		}
+
+		seg.setState(index, stateQueued)
+		count += 1
+
+		handler(rec, &Position{
+			seg:   seg,
+			index: index,
+		})
+	}
+
+	if seg.closed && seg.pending <= 0 {
+		s.remove(seg)
+	}
+
+	return
+}
+
+func (s *Spool) Evicted() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.evicted
+}
+
+func (s *Spool) Spilled() (count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, seg := range s.segments {
+		count += seg.spilled
+	}
+
+	return
+}
+
+func (s *Spool) Close() (err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.closed = true
+
+	if s.active != nil {
+		s.active.closed = true
+		s.active = nil
+	}
+
+	if s.file != nil {
+		_ = s.file.Sync()
+		err = s.file.Close()
+		s.file = nil
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "spool: Failed to close segment"),
+			}
+			return
+		}
+	}
+
+	for _, seg := range append([]*segment{}, s.segments...) {
+		seg.closeAcks()
+
+		if seg.pending <= 0 {
+			s.remove(seg)
+			continue
+		}
+
+		if seg.pending == len(seg.states) {
+			continue
+		}
+
+		err = s.compact(seg)
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func (s *Spool) compact(seg *segment) (err error) {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "spool: Failed to open segment"),
+		}
+		return
+	}
+	defer file.Close()
+
+	tmpPath := seg.path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath,
+		os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "spool: Failed to create segment"),
+		}
+		return
+	}
+	defer tmpFile.Close()
+
+	size := int64(0)
+	states := []byte{}
+	reader := bufio.NewReader(file)
+	for index := 0; index < len(seg.states); index++ {
+		line, e := reader.ReadBytes('\n')
+		if e != nil {
+			err = &errortypes.ReadError{
+				errors.Wrap(e, "spool: Failed to read segment"),
+			}
+			return
+		}
+
+		if seg.states[index] == stateDone {
+			continue
+		}
+
+		_, err = tmpFile.Write(line)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "spool: Failed to write segment"),
+			}
+			return
+		}
+
+		size += int64(len(line))
+		states = append(states, stateSpilled)
+	}
+
+	err = tmpFile.Sync()
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "spool: Failed to sync segment"),
+		}
+		return
+	}
+
+	seg.removeAcks()
+
+	err = os.Rename(tmpPath, seg.path)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "spool: Failed to rename segment"),
+		}
+		return
+	}
+
+	s.size += size - seg.size
+	seg.size = size
+	seg.states = states
+	seg.pending = len(states)
+	seg.spilled = len(states)
+
+	return
+}
+
+func (s *Spool) segmentSize() int64 {
+	if s.maxSize < segmentSize*4 {
+		return s.maxSize / 4
+	}
+	return segmentSize
+}
+
+func (s *Spool) roll() (err error) {
+	id := s.nextId
+	s.nextId += 1
+
+	seg := &segment{
+		id:       id,
+		path:     filepath.Join(s.dir, segmentName(id)),
+		ackPath:  filepath.Join(s.dir, segmentName(id)+ackExt),
+		modified: time.Now(),
+		states:   []byte{},
+	}
+
+	file, err := os.OpenFile(seg.path,
+		os.O_APPEND|os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "spool: Failed to create segment"),
+		}
+		return
+	}
+
+	if s.file != nil {
+		_ = s.file.Sync()
+		_ = s.file.Close()
+	}
+
+	prev := s.active
+	s.file = file
+	s.active = seg
+	s.segments = append(s.segments, seg)
+
+	if prev != nil {
+		prev.closed = true
+		if prev.pending <= 0 {
+			s.remove(prev)
+		}
+	}
+
+	return
+}
+
+func (s *Spool) evict() {
+	for len(s.segments) > 1 {
+		seg := s.segments[0]
+		if s.size <= s.maxSize && time.Since(seg.modified) <= s.maxAge {
+			break
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"segment": seg.path,
+			"spilled": seg.spilled,
+		}).Warn("spool: Evicting spool segment")
+
+		s.evicted += int64(seg.spilled)
+		s.remove(seg)
+	}
+}
+
+func (s *Spool) remove(seg *segment) {
+	if seg.removed {
+		return
+	}
+	seg.removed = true
+
+	for i, sg := range s.segments {
+		if sg == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			break
+		}
+	}
+	s.size -= seg.size
+
+	seg.removeAcks()
+
+	if seg == s.active {
+		if s.file != nil {
+			_ = s.file.Close()
+			s.file = nil
+		}
+		s.active = nil
+	}
+
+	err := os.Remove(seg.path)
+	if err != nil && !os.IsNotExist(err) {
+		logrus.WithFields(logrus.Fields{
+			"segment": seg.path,
+			"error":   err,
+		}).Error("spool: Failed to remove segment")
+	}
+}
+
+func (s *Spool) load() (err error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "spool: Failed to read spool directory"),
+		}
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+
+		id, e := strconv.ParseUint(
+			strings.TrimSuffix(name, segmentExt), 10, 64)
+		if e != nil {
+			continue
+		}
+
+		seg := &segment{
+			id:       id,
+			path:     filepath.Join(s.dir, name),
+			ackPath:  filepath.Join(s.dir, name+ackExt),
+			size:     entry.Size(),
+			modified: entry.ModTime(),
+			closed:   true,
+		}
+
+		count, e := countRecords(seg.path)
+		if e != nil {
+			err = e
+			return
+		}
+
+		if count == 0 {
+			_ = os.Remove(seg.path)
+			seg.removeAcks()
+			continue
+		}
+
+		seg.states = make([]byte, count)
+		for i := range seg.states {
+			seg.states[i] = stateSpilled
+		}
+		seg.pending = count
+		seg.spilled = count
+
+		err = seg.loadAcks()
+		if err != nil {
+			return
+		}
+
+		if seg.pending <= 0 {
+			_ = os.Remove(seg.path)
+			seg.removeAcks()
+			continue
+		}
+
+		s.segments = append(s.segments, seg)
+		s.size += seg.size
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+
+	if len(s.segments) > 0 {
+		s.nextId = s.segments[len(s.segments)-1].id + 1
+	}
+
+	return
+}
+
+func segmentName(id uint64) string {
+	return fmt.Sprintf("%020d%s", id, segmentExt)
+}
+
+func countRecords(pth string) (count int, err error) {
+	file, err := os.Open(pth)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "spool: Failed to open segment"),
+		}
+		return
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		_, e := reader.ReadBytes('\n')
+		if e != nil {
+			break
+		}
+		count += 1
+	}
+
+	return
+}
+
+func Open(dir string, maxSize int64, maxAge time.Duration) (
+	spl *Spool, err error) {
+
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxAge <= 0 {
+		maxAge = DefaultMaxAge
+	}
+
+	err = utils.ExistsMkdir(dir, 0700)
+	if err != nil {
+		return
+	}
+
+	s := &Spool{
+		dir:      dir,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		segments: []*segment{},
+	}
+
+	err = s.load()
+	if err != nil {
+		return
+	}
+
+	s.lock.Lock()
+	s.evict()
+	s.lock.Unlock()
+
+	spl = s
+
+	return
+}
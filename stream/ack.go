@@ -0,0 +1,139 @@
+package stream
+
+import (
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/sirupsen/logrus"
+)
+
+type ackRange struct {
+	Start uint64
+	End   uint64
+}
+
+func (s *Stream) LoadAck(ackData []byte) (err error) {
+	rangesData := [][]uint64{}
+	err = json.Unmarshal(ackData, &rangesData)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "stream: Failed to unmarshal ack"),
+		}
+		return
+	}
+
+	ranges := []*ackRange{}
+	for _, rangeData := range rangesData {
+		if len(rangeData) != 2 || rangeData[0] > rangeData[1] {
+			err = &errortypes.ParseError{
+				errors.New("stream: Invalid ack range"),
+			}
+			return
+		}
+
+		ranges = append(ranges, &ackRange{
+			Start: rangeData[0],
+			End:   rangeData[1],
+		})
+	}
+
+	s.acks <- ranges
+
+	return
+}
+
+func (s *Stream) ack(seq uint64) {
+	ent, ok := s.unacked[seq]
+	if !ok {
+		return
+	}
+
+	delete(s.unacked, seq)
+	s.done(ent)
+}
+
+func (s *Stream) ackRanges(ranges []*ackRange) {
+	for _, rng := range ranges {
+		if rng.End-rng.Start >= uint64(len(s.unacked)) {
+			for seq := range s.unacked {
+				if seq >= rng.Start && seq <= rng.End {
+					s.ack(seq)
+				}
+			}
+		} else {
+			for seq := rng.Start; ; seq++ {
+				s.ack(seq)
+				if seq == rng.End {
+					break
+				}
+			}
+		}
+	}
+}
+
+func (s *Stream) checkAcks() (err error) {
+	for len(s.acks) > 0 {
+		s.ackRanges(<-s.acks)
+	}
+
+	oldest := time.Time{}
+	for _, ent := range s.unacked {
+		if oldest.IsZero() || ent.sent.Before(oldest) {
+			oldest = ent.sent
+		}
+	}
+
+	if !oldest.IsZero() && time.Since(oldest) > ackTimeout {
+		err = &errortypes.TimeoutError{
+			errors.Newf("stream: No ack received for %d docs",
+				len(s.unacked)),
+		}
+		return
+	}
+
+	return
+}
+
+func (s *Stream) RecoverBuffer() {
+	for len(s.acks) > 0 {
+		s.ackRanges(<-s.acks)
+	}
+
+	seqs := make([]uint64, 0, len(s.unacked))
+	for seq := range s.unacked {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+
+	dropped := 0
+	for _, seq := range seqs {
+		ent := s.unacked[seq]
+		delete(s.unacked, seq)
+
+		if len(s.secondary) > secondaryBufferSize-100 {
+			if !s.spill(ent) {
+				dropped += 1
+			}
+			continue
+		}
+
+		s.secondary <- ent
+	}
+
+	s.updateUnacked()
+	atomic.AddUint64(&s.stats.retransmitted, uint64(len(seqs)-dropped))
+	atomic.AddUint64(&s.stats.dropped, uint64(dropped))
+
+	if dropped > 0 {
+		logrus.WithFields(logrus.Fields{
+			"length":  len(s.secondary),
+			"dropped": dropped,
+		}).Error("stream: Buffer full on recover, dropping docs")
+	}
+}
@@ -0,0 +1,188 @@
+package stream
+
+import (
+	"bytes"
+	"compress/flate"
+	"sync/atomic"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/gorilla/websocket"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+func (s *Stream) collectBatch(ent *entry) (ents []*entry) {
+	ents = []*entry{ent}
+
+	if !s.features.Contains(featureBatch) {
+		return
+	}
+
+	max := batchMaxDocs
+	if unackedBufferSize-len(s.unacked) < max {
+		max = unackedBufferSize - len(s.unacked)
+	}
+
+	for len(ents) < max {
+		select {
+		case ent, ok := <-s.primary:
+			if !ok {
+				return
+			}
+			ents = append(ents, ent)
+			continue
+		default:
+		}
+
+		select {
+		case ent, ok := <-s.secondary:
+			if !ok {
+				return
+			}
+			ents = append(ents, ent)
+			continue
+		default:
+		}
+
+		break
+	}
+
+	return
+}
+
+func (s *Stream) WriteBatch(conn *websocket.Conn, ents []*entry,
+	seqs, compress bool) (err error) {
+
+	payload := &bytes.Buffer{}
+	if s.features.Contains(featureMsgpack) {
+		encoder := newMsgpackEncoder(payload)
+
+		for _, ent := range ents {
+			seq := uint64(0)
+			if seqs {
+				seq = ent.seq
+			}
+
+			err = encoder.EncodeArrayLen(3)
+			if err == nil {
+				err = encoder.EncodeString(ent.doc.GetType())
+			}
+			if err == nil {
+				err = encoder.EncodeUint(seq)
+			}
+			if err != nil {
+				err = &errortypes.WriteError{
+					errors.Wrap(err, "stream: Failed to write msgpack header"),
+				}
+				return
+			}
+
+			err = encoder.Encode(ent.doc)
+			if err != nil {
+				err = &errortypes.WriteError{
+					errors.Wrap(err, "stream: Failed to write msgpack"),
+				}
+				return
+			}
+		}
+	} else {
+		for _, ent := range ents {
+			seq := uint64(0)
+			if seqs {
+				seq = ent.seq
+			}
+
+			err = s.encodeDoc(payload, ent.doc, seq)
+			if err != nil {
+				return
+			}
+		}
+	}
+
+	msg := &bytes.Buffer{}
+	if compress {
+		msg.Write([]byte("batch:deflate:"))
+
+		writer, e := flate.NewWriter(msg, flate.DefaultCompression)
+		if e != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(e, "stream: Failed to create compressor"),
+			}
+			return
+		}
+
+		_, err = writer.Write(payload.Bytes())
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "stream: Failed to compress batch"),
+			}
+			return
+		}
+
+		err = writer.Close()
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "stream: Failed to compress batch"),
+			}
+			return
+		}
+	} else {
+		msg.Write([]byte("batch:none:"))
+		msg.Write(payload.Bytes())
+	}
+
+	err = s.writeMessage(conn, msg.Bytes())
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *Stream) writeEntries(conn *websocket.Conn, ents []*entry) (
+	err error) {
+
+	ackEnabled := s.features.Contains(featureAck)
+
+	sent := time.Now()
+	for _, ent := range ents {
+		ent.sent = sent
+		s.unacked[ent.seq] = ent
+	}
+
+	err = conn.SetWriteDeadline(time.Now().Add(endpointWriteTimeout))
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "stream: Failed to set write deadline"),
+		}
+		return
+	}
+
+	if len(ents) == 1 {
+		seq := uint64(0)
+		if ackEnabled {
+			seq = ents[0].seq
+		}
+
+		err = s.WriteDoc(conn, ents[0].doc, seq)
+	} else {
+		err = s.WriteBatch(conn, ents, ackEnabled,
+			s.features.Contains(featureDeflate))
+	}
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "stream: Failed to write docs"),
+		}
+		return
+	}
+
+	atomic.AddUint64(&s.stats.sent, uint64(len(ents)))
+
+	if !ackEnabled {
+		for _, ent := range ents {
+			s.ack(ent.seq)
+		}
+	}
+
+	return
+}
@@ -1,11 +1,32 @@
 package stream
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/dropbox/godropbox/errors"
+	"github.com/gorilla/websocket"
+	"github.com/pritunl/pritunl-endpoint/constants"
 	"github.com/pritunl/pritunl-endpoint/errortypes"
 	"github.com/pritunl/pritunl-endpoint/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	confFileName             = "conf.json"
+	maxCheckBodySize         = 64 * 1024
+	defaultCheckResponseSize = 1024 * 1024
+	maxCheckResponseSize     = 10 * 1024 * 1024
+	defaultCheckRedirects    = 10
+	maxCheckRedirects        = 20
 )
 
 var (
@@ -24,6 +45,167 @@ type Check struct {
 	Method     string    `json:"method"`
 	StatusCode int       `json:"status_code"`
 	Headers    []*Header `json:"headers"`
+	Count      int       `json:"count"`
+	ExpiryDays int       `json:"expiry_days"`
+	Resolver   string    `json:"resolver"`
+	RecordType string    `json:"record_type"`
+	Expected   string    `json:"expected"`
+
+	Body            string           `json:"body"`
+	BodyContains    string           `json:"body_contains"`
+	BodyRegex       string           `json:"body_regex"`
+	JsonAssertions  []*JsonAssertion `json:"json_assertions"`
+	ExpectedHeaders []*Header        `json:"expected_headers"`
+	MaxResponseSize int64            `json:"max_response_size"`
+	TlsSkipVerify   bool             `json:"tls_skip_verify"`
+	TlsCa           string           `json:"tls_ca"`
+	TlsClientCert   string           `json:"tls_client_cert"`
+	TlsClientKey    string           `json:"tls_client_key"`
+	TlsServerName   string           `json:"tls_server_name"`
+	NoRedirects     bool             `json:"no_redirects"`
+	MaxRedirects    int              `json:"max_redirects"`
+	HttpVersion     string           `json:"http_version"`
+
+	bodyRegex *regexp.Regexp
+	tlsConfig *tls.Config
+}
+
+type JsonAssertion struct {
+	Path  string `json:"path"`
+	Value string `json:"value"`
+
+	segments []*utils.JsonPathSegment
+}
+
+func (j *JsonAssertion) Segments() []*utils.JsonPathSegment {
+	return j.segments
+}
+
+func (c *Check) BodyRegexp() *regexp.Regexp {
+	return c.bodyRegex
+}
+
+func (c *Check) TlsConfig() *tls.Config {
+	if c.tlsConfig == nil {
+		return nil
+	}
+	return c.tlsConfig.Clone()
+}
+
+func (c *Check) loadTlsConfig() (err error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TlsSkipVerify,
+		ServerName:         c.TlsServerName,
+	}
+
+	if c.TlsCa != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(c.TlsCa)) {
+			err = &errortypes.ParseError{
+				errors.New("stream: Check tls ca is invalid"),
+			}
+			return
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.TlsClientCert != "" || c.TlsClientKey != "" {
+		cert, e := tls.X509KeyPair(
+			[]byte(c.TlsClientCert), []byte(c.TlsClientKey))
+		if e != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(e, "stream: Check tls client cert is invalid"),
+			}
+			return
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	c.tlsConfig = tlsConfig
+
+	return
+}
+
+func (c *Check) validateHttp() (err error) {
+	if len(c.Body) > maxCheckBodySize {
+		err = &errortypes.ParseError{
+			errors.New("stream: Check request body too large"),
+		}
+		return
+	}
+
+	if c.BodyRegex != "" {
+		if c.bodyRegex == nil || c.bodyRegex.String() != c.BodyRegex {
+			c.bodyRegex, err = regexp.Compile(c.BodyRegex)
+			if err != nil {
+				err = &errortypes.ParseError{
+					errors.Wrap(err, "stream: Check body regex is invalid"),
+				}
+				return
+			}
+		}
+	} else {
+		c.bodyRegex = nil
+	}
+
+	if c.JsonAssertions == nil {
+		c.JsonAssertions = []*JsonAssertion{}
+	}
+
+	for _, assertion := range c.JsonAssertions {
+		if assertion.segments != nil {
+			continue
+		}
+
+		assertion.segments, err = utils.ParseJsonPath(assertion.Path)
+		if err != nil {
+			return
+		}
+	}
+
+	if c.ExpectedHeaders == nil {
+		c.ExpectedHeaders = []*Header{}
+	}
+
+	for _, header := range c.ExpectedHeaders {
+		header.Key = utils.FilterStr(header.Key, 256)
+		header.Value = utils.FilterStr(header.Value, 2048)
+	}
+
+	if c.MaxResponseSize <= 0 {
+		c.MaxResponseSize = defaultCheckResponseSize
+	} else if c.MaxResponseSize > maxCheckResponseSize {
+		c.MaxResponseSize = maxCheckResponseSize
+	}
+
+	if c.MaxRedirects <= 0 {
+		c.MaxRedirects = defaultCheckRedirects
+	} else if c.MaxRedirects > maxCheckRedirects {
+		c.MaxRedirects = maxCheckRedirects
+	}
+
+	switch c.HttpVersion {
+	case "", "1.1", "2":
+		break
+	default:
+		err = &errortypes.ParseError{
+			errors.Newf("stream: Check http version (%s) is invalid",
+				c.HttpVersion),
+		}
+		return
+	}
+
+	c.TlsServerName = utils.FilterStr(c.TlsServerName, 256)
+
+	if c.tlsConfig == nil {
+		err = c.loadTlsConfig()
+		if err != nil {
+			return
+		}
+	}
+
+	return
 }
 
 func (c *Check) Validate() (err error) {
@@ -56,30 +238,91 @@ func (c *Check) Validate() (err error) {
 
 	switch c.Type {
 	case "http":
+		switch c.Method {
+		case "GET":
+			break
+		case "HEAD":
+			break
+		case "POST":
+			break
+		case "PUT":
+			break
+		case "DELETE":
+			break
+		default:
+			err = &errortypes.ParseError{
+				errors.Newf("stream: Check method (%s) is invalid", c.Method),
+			}
+			return
+		}
+
+		err = c.validateHttp()
+		if err != nil {
+			return
+		}
 		break
 	case "ping":
+		if c.Count < 1 {
+			c.Count = 3
+		} else if c.Count > 20 {
+			c.Count = 20
+		}
 		break
-	default:
-		err = &errortypes.ParseError{
-			errors.Newf("stream: Check type (%s) is invalid", c.Type),
+	case "tcp", "tls":
+		for _, target := range c.Targets {
+			_, port, e := net.SplitHostPort(target)
+			if (e != nil && c.Type != "tls") || (e == nil && port == "") {
+				err = &errortypes.ParseError{
+					errors.Newf(
+						"stream: Check target (%s) missing port",
+						target,
+					),
+				}
+				return
+			}
 		}
-		return
-	}
 
-	switch c.Method {
-	case "GET":
-		break
-	case "HEAD":
-		break
-	case "POST":
-		break
-	case "PUT":
+		if c.ExpiryDays == 0 {
+			c.ExpiryDays = 14
+		}
 		break
-	case "DELETE":
+	case "dns":
+		c.RecordType = strings.ToUpper(c.RecordType)
+		switch c.RecordType {
+		case "":
+			c.RecordType = "A"
+		case "A", "AAAA", "CNAME", "MX", "TXT":
+			break
+		default:
+			err = &errortypes.ParseError{
+				errors.Newf("stream: Check record type (%s) is invalid",
+					c.RecordType),
+			}
+			return
+		}
+
+		if c.Resolver != "" {
+			_, _, e := net.SplitHostPort(c.Resolver)
+			if e != nil {
+				if net.ParseIP(strings.Trim(c.Resolver, "[]")) == nil {
+					err = &errortypes.ParseError{
+						errors.Newf("stream: Check resolver (%s) is invalid",
+							c.Resolver),
+					}
+					return
+				}
+				c.Resolver = net.JoinHostPort(
+					strings.Trim(c.Resolver, "[]"), "53")
+			}
+		}
+
+		if len(c.Expected) > 1024 {
+			c.Expected = c.Expected[:1024]
+		}
 		break
 	default:
 		err = &errortypes.ParseError{
-			errors.Newf("stream: Check method (%s) is invalid", c.Method),
+			errors.Newf("stream: Check type (%s) is invalid", c.Type),
 		}
 		return
 	}
@@ -124,6 +367,134 @@ type Header struct {
 	Value string `json:"value"`
 }
 
+type InputConf struct {
+	Enabled *bool           `json:"enabled"`
+	Rate    int             `json:"rate"`
+	Options json.RawMessage `json:"options"`
+}
+
 type Conf struct {
-	Checks []*Check `json:"checks"`
+	Version   int64                 `json:"version"`
+	Issued    int64                 `json:"issued"`
+	Timestamp int64                 `json:"timestamp"`
+	Nonce     string                `json:"nonce"`
+	Checks    []*Check              `json:"checks"`
+	Inputs    map[string]*InputConf `json:"inputs"`
+}
+
+type ConfAck struct {
+	Version int64 `json:"version"`
+	Issued  int64 `json:"issued"`
+}
+
+func getConfPath() string {
+	return filepath.Join(constants.VarDir, confFileName)
+}
+
+func loadConfFile() {
+	data, err := ioutil.ReadFile(getConfPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.WithFields(logrus.Fields{
+				"error": err,
+			}).Error("stream: Failed to read saved conf")
+		}
+		return
+	}
+
+	conf := &Conf{}
+	err = json.Unmarshal(data, conf)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("stream: Failed to parse saved conf")
+		return
+	}
+
+	CurrentConf = conf
+
+	logrus.WithFields(logrus.Fields{
+		"version": conf.Version,
+	}).Info("stream: Loaded saved conf")
+}
+
+func saveConfFile(conf *Conf) (err error) {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "stream: Failed to marshal conf"),
+		}
+		return
+	}
+
+	err = utils.ExistsMkdir(constants.VarDir, 0700)
+	if err != nil {
+		return
+	}
+
+	pth := getConfPath()
+	tmpPth := pth + ".tmp"
+
+	err = ioutil.WriteFile(tmpPth, data, 0600)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "stream: Failed to write conf"),
+		}
+		return
+	}
+
+	err = os.Rename(tmpPth, pth)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "stream: Failed to write conf"),
+		}
+		return
+	}
+
+	return
+}
+
+func (s *Stream) queueConfAck(conf *Conf) {
+	if conf == nil || conf.Version == 0 ||
+		!s.features.Contains(featureConfAck) {
+
+		return
+	}
+
+	select {
+	case s.confAcks <- &ConfAck{
+		Version: conf.Version,
+		Issued:  conf.Issued,
+	}:
+	default:
+	}
+}
+
+func (s *Stream) writeConfAck(conn *websocket.Conn, confAck *ConfAck) (
+	err error) {
+
+	data, err := json.Marshal(confAck)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "stream: Failed to marshal conf ack"),
+		}
+		return
+	}
+
+	err = conn.SetWriteDeadline(time.Now().Add(endpointWriteTimeout))
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "stream: Failed to set write deadline"),
+		}
+		return
+	}
+
+	msg := append([]byte(featureConfAck+":"), data...)
+
+	err = s.writeMessage(conn, msg)
+	if err != nil {
+		return
+	}
+
+	return
 }
@@ -0,0 +1,180 @@
+package stream
+
+import (
+	"encoding/base64"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/endpoint"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	rotateInterval  = 30 * 24 * time.Hour
+	rotateGrace     = 1 * time.Hour
+	rotateCheckRate = 10 * time.Minute
+	rotateRetry     = 1 * time.Hour
+)
+
+type keyPair struct {
+	clientPrivKey [32]byte
+	serverPubKey  [32]byte
+	expires       time.Time
+}
+
+func decodeKey(key64, name string) (key [32]byte, err error) {
+	keyByt, err := base64.StdEncoding.DecodeString(key64)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrapf(err, "stream: Failed to decode %s", name),
+		}
+		return
+	}
+
+	if len(keyByt) != 32 {
+		err = &errortypes.ParseError{
+			errors.Newf("stream: Invalid %s length", name),
+		}
+		return
+	}
+
+	copy(key[:], keyByt)
+
+	return
+}
+
+func newKeyPair(clientPrivKey64, serverPubKey64 string) (
+	pair *keyPair, err error) {
+
+	pair = &keyPair{}
+
+	pair.clientPrivKey, err = decodeKey(clientPrivKey64,
+		"client private key")
+	if err != nil {
+		return
+	}
+
+	pair.serverPubKey, err = decodeKey(serverPubKey64, "server public key")
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *Stream) LoadKeys() (err error) {
+	pair, err := newKeyPair(config.Config.PrivateKey,
+		config.Config.ServerPublicKey)
+	if err != nil {
+		return
+	}
+
+	keys := []*keyPair{pair}
+
+	expires := time.Unix(config.Config.PreviousKeyExpires, 0)
+	if config.Config.PreviousPrivateKey != "" && time.Now().Before(expires) {
+		prevPair, e := newKeyPair(config.Config.PreviousPrivateKey,
+			config.Config.PreviousServerPublicKey)
+		if e != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": e,
+			}).Error("stream: Failed to load previous endpoint key")
+		} else {
+			prevPair.expires = expires
+			keys = append(keys, prevPair)
+		}
+	}
+
+	s.keysLock.Lock()
+	s.keys = keys
+	s.keysLock.Unlock()
+
+	return
+}
+
+func (s *Stream) getKeys() (keys []*keyPair) {
+	s.keysLock.RLock()
+	allKeys := s.keys
+	s.keysLock.RUnlock()
+
+	now := time.Now()
+	for _, pair := range allKeys {
+		if !pair.expires.IsZero() && now.After(pair.expires) {
+			continue
+		}
+		keys = append(keys, pair)
+	}
+
+	return
+}
+
+func (s *Stream) rotateKeys() (err error) {
+	conf := config.Config.Rotation
+
+	if config.Config.PreviousPrivateKey != "" &&
+		time.Now().Unix() > config.Config.PreviousKeyExpires {
+
+		err = config.Update(func(c *config.ConfigData) (err error) {
+			c.PreviousPrivateKey = ""
+			c.PreviousServerPublicKey = ""
+			c.PreviousKeyExpires = 0
+			return
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	if config.Config.KeyTimestamp == 0 {
+		err = config.Update(func(c *config.ConfigData) (err error) {
+			c.KeyTimestamp = time.Now().Unix()
+			return
+		})
+		if err != nil {
+			return
+		}
+	}
+
+	keyAge := time.Since(time.Unix(config.Config.KeyTimestamp, 0))
+	if keyAge < getDuration(conf.Interval, rotateInterval) {
+		return
+	}
+
+	err = endpoint.RotateKey(getDuration(conf.Grace, rotateGrace))
+	if err != nil {
+		return
+	}
+
+	err = s.LoadKeys()
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *Stream) rotateRunner() {
+	if config.Config.Rotation.Disabled {
+		return
+	}
+
+	for {
+		delay := rotateCheckRate
+
+		err := s.rotateKeys()
+		if err != nil {
+			delay = rotateRetry
+
+			logrus.WithFields(logrus.Fields{
+				"retry": delay.String(),
+				"error": err,
+			}).Error("stream: Failed to rotate endpoint key")
+		}
+
+		if !s.sleep(delay) {
+			return
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package stream
+
+func (s *Stream) Observe(handler func(doc Doc)) {
+	s.observersLock.Lock()
+	s.observers = append(s.observers, handler)
+	s.observersLock.Unlock()
+}
+
+func (s *Stream) notify(doc Doc) {
+	s.observersLock.RLock()
+	observers := s.observers
+	s.observersLock.RUnlock()
+
+	for _, handler := range observers {
+		handler(doc)
+	}
+}
@@ -0,0 +1,45 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/utils"
+)
+
+const (
+	reconnectBackoffMin     = 1 * time.Second
+	reconnectBackoffMax     = 2 * time.Minute
+	reconnectAuthBackoffMin = 1 * time.Minute
+	reconnectAuthBackoffMax = 1 * time.Hour
+	reconnectStableTime     = reconnectBackoffMax
+)
+
+func getDuration(val int, def time.Duration) time.Duration {
+	if val <= 0 {
+		return def
+	}
+	return time.Duration(val) * time.Second
+}
+
+func newBackoffs() (backoff, authBackoff *utils.Backoff) {
+	conf := config.Config.Reconnect
+
+	backoff = &utils.Backoff{
+		Min: getDuration(conf.BackoffMin, reconnectBackoffMin),
+		Max: getDuration(conf.BackoffMax, reconnectBackoffMax),
+	}
+	if backoff.Max < backoff.Min {
+		backoff.Max = backoff.Min
+	}
+
+	authBackoff = &utils.Backoff{
+		Min: getDuration(conf.AuthBackoffMin, reconnectAuthBackoffMin),
+		Max: getDuration(conf.AuthBackoffMax, reconnectAuthBackoffMax),
+	}
+	if authBackoff.Max < authBackoff.Min {
+		authBackoff.Max = authBackoff.Min
+	}
+
+	return
+}
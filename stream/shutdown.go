@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/gorilla/websocket"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/sirupsen/logrus"
+)
+
+func (s *Stream) drain(conn *websocket.Conn) (err error) {
+	deadline := s.stopDeadline
+
+	for time.Now().Before(deadline) {
+		var ent *entry
+
+		select {
+		case ent = <-s.primary:
+		default:
+			select {
+			case ent = <-s.secondary:
+			default:
+			}
+		}
+
+		if ent == nil {
+			break
+		}
+
+		err = s.writeEntries(conn, s.collectBatch(ent))
+		if err != nil {
+			return
+		}
+	}
+
+	if s.features.Contains(featureAck) {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+
+		for len(s.unacked) > 0 {
+			select {
+			case ranges := <-s.acks:
+				s.ackRanges(ranges)
+				continue
+			case <-timer.C:
+			}
+			break
+		}
+	}
+
+	err = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+		time.Now().Add(endpointWriteTimeout))
+	if err != nil {
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "stream: Failed to write close message"),
+		}
+		return
+	}
+
+	return
+}
+
+func (s *Stream) sleep(delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.stop:
+		return false
+	}
+}
+
+func (s *Stream) Close(timeout time.Duration) {
+	s.stopOnce.Do(func() {
+		s.stopDeadline = time.Now().Add(timeout)
+		close(s.stop)
+	})
+
+	timer := time.NewTimer(timeout + endpointWriteTimeout)
+	defer timer.Stop()
+
+	finished := false
+	select {
+	case <-s.finished:
+		finished = true
+	case <-timer.C:
+		logrus.Warn("stream: Timed out waiting for stream to stop")
+	}
+
+	remaining := len(s.primary) + len(s.secondary)
+	if finished {
+		remaining += len(s.unacked)
+	}
+
+	if s.spool == nil {
+		if remaining > 0 {
+			logrus.WithFields(logrus.Fields{
+				"remaining": remaining,
+			}).Warn("stream: Spool disabled, dropping undelivered docs")
+		}
+		return
+	}
+
+	err := s.spool.Close()
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("stream: Failed to close spool")
+		return
+	}
+
+	if remaining > 0 {
+		logrus.WithFields(logrus.Fields{
+			"remaining": remaining,
+		}).Info("stream: Undelivered docs persisted to spool")
+	}
+}
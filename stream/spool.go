@@ -0,0 +1,210 @@
+package stream
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/constants"
+	"github.com/pritunl/pritunl-endpoint/spool"
+	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var (
+	docTypes     = map[string]func() Doc{}
+	docTypesLock sync.RWMutex
+)
+
+type entry struct {
+	doc  Doc
+	seq  uint64
+	pos  *spool.Position
+	sent time.Time
+}
+
+type rawDoc struct {
+	typ       string
+	timestamp time.Time
+	data      json.RawMessage
+}
+
+func (d *rawDoc) GetTimestamp() time.Time {
+	return d.timestamp
+}
+
+func (d *rawDoc) SetTimestamp(timestamp time.Time) {
+	d.timestamp = timestamp
+}
+
+func (d *rawDoc) GetType() string {
+	return d.typ
+}
+
+func (d *rawDoc) MarshalJSON() ([]byte, error) {
+	return d.data, nil
+}
+
+func (d *rawDoc) EncodeMsgpack(encoder *msgpack.Encoder) (err error) {
+	var val interface{}
+
+	err = json.Unmarshal(d.data, &val)
+	if err != nil {
+		return
+	}
+
+	err = encoder.Encode(val)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func RegisterDoc(typ string, newDoc func() Doc) {
+	docTypesLock.Lock()
+	docTypes[typ] = newDoc
+	docTypesLock.Unlock()
+}
+
+func loadDoc(rec *spool.Record) (doc Doc) {
+	docTypesLock.RLock()
+	newDoc := docTypes[rec.Type]
+	docTypesLock.RUnlock()
+
+	if newDoc != nil {
+		doc = newDoc()
+
+		err := json.Unmarshal(rec.Data, doc)
+		if err == nil {
+			return
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"type":  rec.Type,
+			"error": err,
+		}).Error("stream: Failed to unmarshal spooled doc")
+	}
+
+	doc = &rawDoc{
+		typ:       rec.Type,
+		timestamp: rec.Timestamp,
+		data:      rec.Data,
+	}
+
+	return
+}
+
+func (s *Stream) initSpool() {
+	conf := config.Config.Spool
+	if conf.Disabled {
+		return
+	}
+
+	spl, err := spool.Open(
+		filepath.Join(constants.VarDir, "spool"),
+		int64(conf.MaxSize)*1024*1024,
+		time.Duration(conf.MaxAge)*time.Second,
+	)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("stream: Failed to open spool, spool disabled")
+		return
+	}
+
+	s.spool = spl
+}
+
+func (s *Stream) newEntry(doc Doc) (ent *entry) {
+	ent = &entry{
+		doc: doc,
+		seq: atomic.AddUint64(&s.sequence, 1),
+	}
+
+	if s.spool == nil {
+		return
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"type":  doc.GetType(),
+			"error": err,
+		}).Error("stream: Failed to marshal doc for spool")
+		return
+	}
+
+	ent.pos, err = s.spool.Write(&spool.Record{
+		Seq:       ent.seq,
+		Type:      doc.GetType(),
+		Timestamp: doc.GetTimestamp(),
+		Data:      data,
+	}, false)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"type":  doc.GetType(),
+			"error": err,
+		}).Error("stream: Failed to write doc to spool")
+		return
+	}
+
+	return
+}
+
+func (s *Stream) spill(ent *entry) bool {
+	if s.spool == nil || ent.pos == nil {
+		return false
+	}
+
+	return s.spool.Spill(ent.pos)
+}
+
+func (s *Stream) done(ent *entry) {
+	if s.spool == nil {
+		return
+	}
+
+	s.spool.Done(ent.pos)
+}
+
+func (s *Stream) replaySpool() {
+	if s.spool == nil {
+		return
+	}
+
+	space := secondaryBufferSize/2 - len(s.secondary)
+	if space <= 0 {
+		return
+	}
+
+	count, err := s.spool.Replay(space,
+		func(rec *spool.Record, pos *spool.Position) {
+			seq := rec.Seq
+			if seq == 0 {
+				seq = atomic.AddUint64(&s.sequence, 1)
+			}
+
+			s.secondary <- &entry{
+				doc: loadDoc(rec),
+				seq: seq,
+				pos: pos,
+			}
+		},
+	)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("stream: Failed to replay spool")
+	}
+
+	if count > 0 {
+		logrus.WithFields(logrus.Fields{
+			"count":   count,
+			"evicted": s.spool.Evicted(),
+		}).Info("stream: Replaying spooled docs")
+	}
+}
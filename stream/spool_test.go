@@ -0,0 +1,96 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pritunl/pritunl-endpoint/spool"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const testType = "test"
+
+type testDoc struct {
+	Timestamp time.Time `json:"t"`
+
+	Usage  float64  `json:"u"`
+	Count  int      `json:"c"`
+	Name   string   `json:"n,omitempty"`
+	Values []uint64 `json:"v"`
+}
+
+func (d *testDoc) GetTimestamp() time.Time {
+	return d.Timestamp
+}
+
+func (d *testDoc) SetTimestamp(timestamp time.Time) {
+	d.Timestamp = timestamp
+}
+
+func (d *testDoc) GetType() string {
+	return testType
+}
+
+func encodeMsgpack(t *testing.T, doc Doc) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	err := newMsgpackEncoder(buf).Encode(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestReplayEncoding(t *testing.T) {
+	RegisterDoc(testType, func() Doc {
+		return &testDoc{}
+	})
+
+	doc := &testDoc{
+		Timestamp: time.Date(2024, 5, 1, 10, 30, 0, 123456789, time.UTC),
+		Usage:     12,
+		Count:     3,
+		Values:    []uint64{1, 1 << 40},
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := loadDoc(&spool.Record{
+		Type:      testType,
+		Timestamp: doc.Timestamp,
+		Data:      data,
+	})
+
+	if _, ok := replayed.(*testDoc); !ok {
+		t.Fatalf("stream: Replayed doc loaded as %T", replayed)
+	}
+
+	live := encodeMsgpack(t, doc)
+	spooled := encodeMsgpack(t, replayed)
+	if !bytes.Equal(live, spooled) {
+		t.Errorf("stream: Replayed msgpack %x, expected %x", spooled, live)
+	}
+
+	val := map[string]interface{}{}
+	err = msgpack.Unmarshal(spooled, &val)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := val["t"].(time.Time); !ok {
+		t.Errorf("stream: Replayed timestamp decoded as %T", val["t"])
+	}
+	if _, ok := val["u"].(float64); !ok {
+		t.Errorf("stream: Replayed float decoded as %T", val["u"])
+	}
+	if _, ok := val["n"]; ok {
+		t.Errorf("stream: Replayed empty field not omitted")
+	}
+}
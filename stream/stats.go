@@ -0,0 +1,74 @@
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type Stats struct {
+	Primary       int
+	Secondary     int
+	Unacked       int
+	Spooled       int
+	Sent          uint64
+	Dropped       uint64
+	Evicted       uint64
+	Retransmitted uint64
+	Reconnects    uint64
+	Connected     bool
+	Host          string
+}
+
+type streamStats struct {
+	sent          uint64
+	dropped       uint64
+	retransmitted uint64
+	connects      uint64
+	reconnects    uint64
+	unacked       int64
+	lock          sync.Mutex
+	host          string
+}
+
+func (s *Stream) setHost(host string) {
+	s.stats.lock.Lock()
+	s.stats.host = host
+	s.stats.lock.Unlock()
+
+	if host == "" {
+		return
+	}
+
+	if atomic.AddUint64(&s.stats.connects, 1) > 1 {
+		atomic.AddUint64(&s.stats.reconnects, 1)
+	}
+}
+
+func (s *Stream) updateUnacked() {
+	atomic.StoreInt64(&s.stats.unacked, int64(len(s.unacked)))
+}
+
+func (s *Stream) Stats() (stats *Stats) {
+	s.stats.lock.Lock()
+	host := s.stats.host
+	s.stats.lock.Unlock()
+
+	stats = &Stats{
+		Primary:       len(s.primary),
+		Secondary:     len(s.secondary),
+		Unacked:       int(atomic.LoadInt64(&s.stats.unacked)),
+		Sent:          atomic.LoadUint64(&s.stats.sent),
+		Dropped:       atomic.LoadUint64(&s.stats.dropped),
+		Retransmitted: atomic.LoadUint64(&s.stats.retransmitted),
+		Reconnects:    atomic.LoadUint64(&s.stats.reconnects),
+		Connected:     host != "",
+		Host:          host,
+	}
+
+	if s.spool != nil {
+		stats.Spooled = s.spool.Spilled()
+		stats.Evicted = uint64(s.spool.Evicted())
+	}
+
+	return
+}
@@ -7,23 +7,33 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/dropbox/godropbox/container/set"
 	"github.com/dropbox/godropbox/errors"
 	"github.com/gorilla/websocket"
 	"github.com/pritunl/pritunl-endpoint/config"
 	"github.com/pritunl/pritunl-endpoint/errortypes"
+	"github.com/pritunl/pritunl-endpoint/nonce"
+	"github.com/pritunl/pritunl-endpoint/remote"
+	"github.com/pritunl/pritunl-endpoint/spool"
+	"github.com/pritunl/pritunl-endpoint/transport"
 	"github.com/pritunl/pritunl-endpoint/utils"
 	"github.com/sirupsen/logrus"
+	"github.com/vmihailenco/msgpack/v5"
 	"golang.org/x/crypto/nacl/box"
 )
 
 var (
 	Dialer = &websocket.Dialer{
+		Proxy:            transport.Proxy,
 		HandshakeTimeout: 45 * time.Second,
 	}
 )
@@ -31,21 +41,68 @@ var (
 const (
 	primaryBufferSize    = 1100
 	secondaryBufferSize  = 50100
-	writingBufferSize    = 1100
-	writingSwap          = 3 * time.Minute
+	unackedBufferSize    = 5000
+	ackBufferSize        = 64
+	confAckBufferSize    = 8
+	batchMaxDocs         = 500
 	endpointWriteTimeout = 10 * time.Second
 	endpointPingInterval = 30 * time.Second
 	endpointPingWait     = 40 * time.Second
+	ackTimeout           = 4 * endpointPingInterval
 )
 
+const (
+	featureAck       = "ack"
+	featureBatch     = "batch"
+	featureDeflate   = "deflate"
+	featureMsgpack   = "msgpack"
+	featureConfAck   = "conf_ack"
+	featureConfNonce = "conf_nonce"
+)
+
+func getFeatures() (features []string) {
+	features = []string{
+		featureAck,
+		featureBatch,
+		featureDeflate,
+		featureConfAck,
+		featureConfNonce,
+	}
+
+	switch config.Config.Encoding {
+	case "", "json":
+		break
+	case featureMsgpack:
+		features = append(features, featureMsgpack)
+	default:
+		logrus.WithFields(logrus.Fields{
+			"encoding": config.Config.Encoding,
+		}).Warn("stream: Ignoring unknown encoding")
+	}
+
+	return
+}
+
 type Stream struct {
-	primary          chan Doc
-	secondary        chan Doc
-	writingTimestamp time.Time
-	writingPresent   chan Doc
-	writingPast      chan Doc
-	clientPrivKey    [32]byte
-	serverPubKey     [32]byte
+	primary       chan *entry
+	secondary     chan *entry
+	acks          chan []*ackRange
+	confAcks      chan *ConfAck
+	unacked       map[uint64]*entry
+	sequence      uint64
+	features      set.Set
+	connected     bool
+	connectedTime time.Time
+	stop          chan struct{}
+	stopOnce      sync.Once
+	stopDeadline  time.Time
+	finished      chan struct{}
+	spool         *spool.Spool
+	stats         streamStats
+	observers     []func(doc Doc)
+	observersLock sync.RWMutex
+	keysLock      sync.RWMutex
+	keys          []*keyPair
 }
 
 type Doc interface {
@@ -55,25 +112,10 @@ type Doc interface {
 }
 
 func (s *Stream) Init() (err error) {
-	clientPrivKey, err := base64.StdEncoding.DecodeString(
-		config.Config.PrivateKey)
+	err = s.LoadKeys()
 	if err != nil {
-		err = &errortypes.ParseError{
-			errors.Wrap(err, "stream: Failed to decode client private key"),
-		}
 		return
 	}
-	copy(s.clientPrivKey[:], clientPrivKey)
-
-	serverPubKey, err := base64.StdEncoding.DecodeString(
-		config.Config.ServerPublicKey)
-	if err != nil {
-		err = &errortypes.ParseError{
-			errors.Wrap(err, "stream: Failed to decode server public key"),
-		}
-		return
-	}
-	copy(s.serverPubKey[:], serverPubKey)
 
 	return
 }
@@ -81,86 +123,99 @@ func (s *Stream) Init() (err error) {
 func (s *Stream) Append(doc Doc) {
 	doc.SetTimestamp(time.Now().UTC())
 
+	ent := s.newEntry(doc)
+
+	s.notify(doc)
+
 	if len(s.primary) > primaryBufferSize-100 {
-		s.AppendSecondary(doc)
+		s.appendSecondary(ent)
 		return
 	}
 
-	s.primary <- doc
+	s.primary <- ent
 }
 
 func (s *Stream) AppendSecondary(doc Doc) {
+	ent := s.newEntry(doc)
+
+	s.notify(doc)
+
+	s.appendSecondary(ent)
+}
+
+func (s *Stream) appendSecondary(ent *entry) {
 	if len(s.secondary) > secondaryBufferSize-100 {
+		if s.spill(ent) {
+			return
+		}
+
+		atomic.AddUint64(&s.stats.dropped, 1)
+
 		logrus.WithFields(logrus.Fields{
 			"length": len(s.secondary),
 		}).Error("stream: Buffer full, dropping doc")
 		return
 	}
 
-	s.secondary <- doc
+	s.secondary <- ent
 }
 
-func (s *Stream) AppendWriting(doc Doc) {
-	if len(s.writingPresent) > writingBufferSize-100 ||
-		time.Since(s.writingTimestamp) > writingSwap {
-
-		s.writingTimestamp = time.Now()
-		s.writingPast = s.writingPresent
-		s.writingPresent = make(chan Doc, writingBufferSize)
-	}
-
-	s.writingPresent <- doc
+func newMsgpackEncoder(w io.Writer) (encoder *msgpack.Encoder) {
+	encoder = msgpack.NewEncoder(w)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+	return
 }
 
-func (s *Stream) RecoverBuffer() {
-	close(s.writingPresent)
-	close(s.writingPast)
-
-	for doc := range s.writingPresent {
-		if len(s.secondary) > secondaryBufferSize-100 {
-			logrus.WithFields(logrus.Fields{
-				"length": len(s.secondary),
-			}).Error("stream: Buffer full on recover present, dropping doc")
-			break
-		}
+func (s *Stream) encodeDoc(msg *bytes.Buffer, doc Doc, seq uint64) (
+	err error) {
 
-		s.secondary <- doc
+	msg.Write([]byte(doc.GetType() + ":"))
+	if seq != 0 {
+		msg.Write([]byte(strconv.FormatUint(seq, 10) + ":"))
 	}
-	for doc := range s.writingPast {
-		if len(s.secondary) > secondaryBufferSize-100 {
-			logrus.WithFields(logrus.Fields{
-				"length": len(s.secondary),
-			}).Error("stream: Buffer full on recover past, dropping doc")
-			break
+
+	if s.features.Contains(featureMsgpack) {
+		err = newMsgpackEncoder(msg).Encode(doc)
+		if err != nil {
+			err = &errortypes.WriteError{
+				errors.Wrap(err, "stream: Failed to write msgpack"),
+			}
+			return
 		}
+		return
+	}
 
-		s.secondary <- doc
+	err = json.NewEncoder(msg).Encode(doc)
+	if err != nil {
+		err = &errortypes.WriteError{
+			errors.Wrap(err, "stream: Failed to write json"),
+		}
+		return
 	}
 
-	s.writingTimestamp = time.Now()
-	s.writingPast = make(chan Doc, writingBufferSize)
-	s.writingPresent = make(chan Doc, writingBufferSize)
+	return
 }
 
-func (s *Stream) WriteDoc(conn *websocket.Conn, doc Doc) (err error) {
-	w, err := conn.NextWriter(websocket.TextMessage)
-	if err != nil {
-		err = &errortypes.RequestError{
-			errors.Wrap(err, "stream: Failed to get writer"),
+func (s *Stream) writeMessage(conn *websocket.Conn, msg []byte) (
+	err error) {
+
+	keys := s.getKeys()
+	if len(keys) == 0 {
+		err = &errortypes.ParseError{
+			errors.New("stream: Missing endpoint keys"),
 		}
 		return
 	}
-	defer w.Close()
 
-	msg := &bytes.Buffer{}
-	msg.Write([]byte(doc.GetType() + ":"))
-	err = json.NewEncoder(msg).Encode(doc)
+	w, err := conn.NextWriter(websocket.TextMessage)
 	if err != nil {
-		err = &errortypes.WriteError{
-			errors.Wrap(err, "stream: Failed to write json"),
+		err = &errortypes.RequestError{
+			errors.Wrap(err, "stream: Failed to get writer"),
 		}
 		return
 	}
+	defer w.Close()
 
 	encMsg, err := utils.RandBytes(24)
 	if err != nil {
@@ -169,8 +224,8 @@ func (s *Stream) WriteDoc(conn *websocket.Conn, doc Doc) (err error) {
 	var nonceAr [24]byte
 	copy(nonceAr[:], encMsg)
 
-	encMsg = box.Seal(encMsg, msg.Bytes(), &nonceAr,
-		&s.serverPubKey, &s.clientPrivKey)
+	encMsg = box.Seal(encMsg, msg, &nonceAr,
+		&keys[0].serverPubKey, &keys[0].clientPrivKey)
 
 	_, err = w.Write(encMsg)
 	if err != nil {
@@ -183,10 +238,27 @@ func (s *Stream) WriteDoc(conn *websocket.Conn, doc Doc) (err error) {
 	return
 }
 
-func (s *Stream) LoadConf(encData []byte) (err error) {
+func (s *Stream) WriteDoc(conn *websocket.Conn, doc Doc, seq uint64) (
+	err error) {
+
+	msg := &bytes.Buffer{}
+	err = s.encodeDoc(msg, doc, seq)
+	if err != nil {
+		return
+	}
+
+	err = s.writeMessage(conn, msg.Bytes())
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func (s *Stream) Decrypt(encData []byte) (data []byte, err error) {
 	if len(encData) < 32 {
 		err = &errortypes.ParseError{
-			errors.Newf("stream: Conf data too short (%d)", len(encData)),
+			errors.Newf("stream: Message data too short (%d)", len(encData)),
 		}
 		return
 	}
@@ -194,15 +266,67 @@ func (s *Stream) LoadConf(encData []byte) (err error) {
 	var nonceAr [24]byte
 	copy(nonceAr[:], encData[:24])
 
-	confData, valid := box.Open([]byte{}, encData[24:],
-		&nonceAr, &s.serverPubKey, &s.clientPrivKey)
+	valid := false
+	for _, keys := range s.getKeys() {
+		data, valid = box.Open([]byte{}, encData[24:],
+			&nonceAr, &keys.serverPubKey, &keys.clientPrivKey)
+		if valid {
+			break
+		}
+	}
 	if !valid {
 		err = &errortypes.ParseError{
-			errors.New("stream: Failed to decrypt conf data"),
+			errors.New("stream: Failed to decrypt message data"),
 		}
 		return
 	}
 
+	return
+}
+
+func (s *Stream) HandleMessage(encData []byte) (err error) {
+	data, err := s.Decrypt(encData)
+	if err != nil {
+		return
+	}
+
+	if len(data) > 0 && data[0] == '{' {
+		err = s.LoadConf(data)
+		if err != nil {
+			return
+		}
+		return
+	}
+
+	msgs := bytes.SplitN(data, []byte(":"), 2)
+	if len(msgs) != 2 {
+		err = &errortypes.ParseError{
+			errors.New("stream: Message missing type"),
+		}
+		return
+	}
+
+	switch string(msgs[0]) {
+	case "conf":
+		err = s.LoadConf(msgs[1])
+		if err != nil {
+			return
+		}
+	case "ack":
+		err = s.LoadAck(msgs[1])
+		if err != nil {
+			return
+		}
+	default:
+		logrus.WithFields(logrus.Fields{
+			"type": string(msgs[0]),
+		}).Warn("stream: Ignoring unknown message type")
+	}
+
+	return
+}
+
+func (s *Stream) LoadConf(confData []byte) (err error) {
 	conf := &Conf{}
 	err = json.Unmarshal(confData, conf)
 	if err != nil {
@@ -212,28 +336,77 @@ func (s *Stream) LoadConf(encData []byte) (err error) {
 		return
 	}
 
+	if s.features.Contains(featureConfNonce) {
+		if len(conf.Nonce) < 16 || len(conf.Nonce) > 128 {
+			err = &errortypes.AuthenticationError{
+				errors.New("stream: Invalid conf nonce"),
+			}
+			return
+		}
+
+		err = nonce.ValidateTimestamp(conf.Nonce,
+			time.Unix(conf.Timestamp, 0))
+		if err != nil {
+			return
+		}
+	}
+
+	curConf := CurrentConf
+	if conf.Version < curConf.Version ||
+		(conf.Version == curConf.Version && conf.Issued < curConf.Issued) {
+
+		err = &errortypes.VerificationError{
+			errors.Newf("stream: Rejected conf rollback from %d to %d",
+				curConf.Version, conf.Version),
+		}
+		return
+	}
+
 	CurrentConf = conf
 
+	err = saveConfFile(conf)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err,
+		}).Error("stream: Failed to save conf")
+		err = nil
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"version": conf.Version,
+	}).Info("stream: Applied conf")
+
+	s.queueConfAck(conf)
+
 	return
 }
 
 func (s *Stream) Conn() (err error) {
+	hosts := remote.Hosts()
+	if len(hosts) == 0 {
+		err = &errortypes.ParseError{
+			errors.New("stream: Config missing remote host"),
+		}
+		return
+	}
+	host := hosts[0]
+
 	streamUrl := &url.URL{
 		Scheme: "wss",
-		Host:   config.Config.RemoteHosts[0],
+		Host:   host,
 		Path:   fmt.Sprintf("/endpoint/%s/comm", config.Config.Id),
 	}
 
 	timestamp := time.Now().Unix()
 	timestampStr := strconv.FormatInt(timestamp, 10)
-	nonce, err := utils.RandStr(64)
+	reqNonce, err := utils.RandStr(64)
 	if err != nil {
 		return
 	}
 
 	authString := strings.Join([]string{
 		timestampStr,
-		nonce,
+		reqNonce,
 		"communicate",
 	}, "&")
 
@@ -244,11 +417,23 @@ func (s *Stream) Conn() (err error) {
 
 	header := http.Header{}
 	header.Add("Pritunl-Endpoint-Timestamp", timestampStr)
-	header.Add("Pritunl-Endpoint-Nonce", nonce)
+	header.Add("Pritunl-Endpoint-Nonce", reqNonce)
 	header.Add("Pritunl-Endpoint-Signature", signature)
+	header.Add("Pritunl-Endpoint-Features",
+		strings.Join(getFeatures(), ","))
+
+	tlsConf, err := transport.TlsConfig()
+	if err != nil {
+		return
+	}
 
-	conn, res, err := Dialer.Dial(streamUrl.String(), header)
+	dialer := *Dialer
+	dialer.TLSClientConfig = tlsConf
+
+	conn, res, err := dialer.Dial(streamUrl.String(), header)
 	if err != nil {
+		remote.Failure(host)
+
 		if res != nil {
 			errData := &errortypes.ErrorData{}
 			e := json.NewDecoder(res.Body).Decode(errData)
@@ -258,12 +443,22 @@ func (s *Stream) Conn() (err error) {
 					"error_msg":  errData.Message,
 				}).Error("endpoint: Communicate error")
 			}
-			err = &errortypes.ConnectionError{
-				errors.Wrapf(
-					err,
-					"stream: Failed to dial stream, status '%d'",
-					res.StatusCode,
-				),
+			if res.StatusCode >= 400 && res.StatusCode < 500 {
+				err = &errortypes.AuthenticationError{
+					errors.Wrapf(
+						err,
+						"stream: Stream dial rejected, status '%d'",
+						res.StatusCode,
+					),
+				}
+			} else {
+				err = &errortypes.ConnectionError{
+					errors.Wrapf(
+						err,
+						"stream: Failed to dial stream, status '%d'",
+						res.StatusCode,
+					),
+				}
 			}
 		} else {
 			err = &errortypes.ConnectionError{
@@ -275,6 +470,27 @@ func (s *Stream) Conn() (err error) {
 	}
 	defer conn.Close()
 
+	remote.Success(host)
+	s.connected = true
+	s.connectedTime = time.Now()
+
+	s.setHost(host)
+	defer s.setHost("")
+
+	s.features = set.NewSet()
+	for _, feature := range strings.Split(
+		res.Header.Get("Pritunl-Endpoint-Features"), ",") {
+
+		feature = strings.TrimSpace(feature)
+		if feature != "" {
+			s.features.Add(feature)
+		}
+	}
+
+	s.replaySpool()
+
+	s.queueConfAck(CurrentConf)
+
 	err = conn.SetReadDeadline(time.Now().Add(endpointPingWait))
 	if err != nil {
 		err = &errortypes.RequestError{
@@ -296,6 +512,7 @@ func (s *Stream) Conn() (err error) {
 	})
 
 	ticker := time.NewTicker(endpointPingInterval)
+	defer ticker.Stop()
 
 	go func() {
 		defer func() {
@@ -304,6 +521,13 @@ func (s *Stream) Conn() (err error) {
 		for {
 			msgType, msgByte, err := conn.ReadMessage()
 			if err != nil {
+				select {
+				case <-s.stop:
+					_ = conn.Close()
+					return
+				default:
+				}
+
 				err = &errortypes.ReadError{
 					errors.Wrap(err, "stream: Failed to read message"),
 				}
@@ -317,11 +541,11 @@ func (s *Stream) Conn() (err error) {
 			}
 
 			if msgType == websocket.TextMessage {
-				err = s.LoadConf(msgByte)
+				err = s.HandleMessage(msgByte)
 				if err != nil {
 					logrus.WithFields(logrus.Fields{
 						"error": err,
-					}).Error("stream: Failed to load conf")
+					}).Error("stream: Failed to handle message")
 					err = nil
 				}
 			}
@@ -329,10 +553,17 @@ func (s *Stream) Conn() (err error) {
 	}()
 
 	for {
-		select {
-		case doc, ok := <-s.primary:
-			s.AppendWriting(doc)
+		s.updateUnacked()
 
+		primary := s.primary
+		secondary := s.secondary
+		if len(s.unacked) >= unackedBufferSize {
+			primary = nil
+			secondary = nil
+		}
+
+		select {
+		case ent, ok := <-primary:
 			if !ok {
 				err = conn.WriteControl(websocket.CloseMessage, []byte{},
 					time.Now().Add(endpointWriteTimeout))
@@ -346,28 +577,11 @@ func (s *Stream) Conn() (err error) {
 				return
 			}
 
-			err = conn.SetWriteDeadline(time.Now().Add(endpointWriteTimeout))
-			if err != nil {
-				s.AppendSecondary(doc)
-				err = &errortypes.RequestError{
-					errors.Wrap(err,
-						"stream: Failed to set write deadline"),
-				}
-				return
-			}
-
-			err = s.WriteDoc(conn, doc)
+			err = s.writeEntries(conn, s.collectBatch(ent))
 			if err != nil {
-				s.AppendSecondary(doc)
-				err = &errortypes.RequestError{
-					errors.Wrap(err,
-						"stream: Failed to set write json"),
-				}
 				return
 			}
-		case doc, ok := <-s.secondary:
-			s.AppendWriting(doc)
-
+		case ent, ok := <-secondary:
 			if !ok {
 				err = conn.WriteControl(websocket.CloseMessage, []byte{},
 					time.Now().Add(endpointWriteTimeout))
@@ -381,25 +595,20 @@ func (s *Stream) Conn() (err error) {
 				return
 			}
 
-			err = conn.SetWriteDeadline(time.Now().Add(endpointWriteTimeout))
+			err = s.writeEntries(conn, s.collectBatch(ent))
 			if err != nil {
-				s.AppendSecondary(doc)
-				err = &errortypes.RequestError{
-					errors.Wrap(err,
-						"stream: Failed to set write secondary deadline"),
-				}
 				return
 			}
-
-			err = s.WriteDoc(conn, doc)
+		case ranges := <-s.acks:
+			s.ackRanges(ranges)
+		case confAck := <-s.confAcks:
+			err = s.writeConfAck(conn, confAck)
 			if err != nil {
-				s.AppendSecondary(doc)
-				err = &errortypes.RequestError{
-					errors.Wrap(err,
-						"stream: Failed to set write secondary json"),
-				}
 				return
 			}
+		case <-s.stop:
+			err = s.drain(conn)
+			return
 		case <-ticker.C:
 			err = conn.WriteControl(websocket.PingMessage, []byte{},
 				time.Now().Add(endpointWriteTimeout))
@@ -410,6 +619,13 @@ func (s *Stream) Conn() (err error) {
 				}
 				return
 			}
+
+			err = s.checkAcks()
+			if err != nil {
+				return
+			}
+
+			s.replaySpool()
 		}
 	}
 }
@@ -417,26 +633,78 @@ func (s *Stream) Conn() (err error) {
 func (s *Stream) Run() {
 	s.Init()
 
+	defer close(s.finished)
+
+	go s.rotateRunner()
+
+	backoff, authBackoff := newBackoffs()
+
 	for {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+
+		s.connected = false
+
 		err := s.Conn()
+
+		s.RecoverBuffer()
+
+		if s.connected &&
+			time.Since(s.connectedTime) >= reconnectStableTime {
+
+			backoff.Reset()
+			authBackoff.Reset()
+		}
+
+		if _, ok := err.(*errortypes.AuthenticationError); ok {
+			delay := authBackoff.Next()
+			backoff.Reset()
+
+			logrus.WithFields(logrus.Fields{
+				"state": "unauthorized",
+				"retry": delay.String(),
+				"error": err,
+			}).Error("stream: Endpoint authentication rejected, " +
+				"endpoint may be revoked")
+
+			s.sleep(delay)
+			continue
+		}
+
+		delay := backoff.Next()
+		authBackoff.Reset()
+
 		if err != nil {
 			logrus.WithFields(logrus.Fields{
+				"state": "disconnected",
+				"retry": delay.String(),
 				"error": err,
 			}).Error("stream: stream conn error")
 		}
 
-		s.RecoverBuffer()
-
-		time.Sleep(1 * time.Second)
+		s.sleep(delay)
 	}
 }
 
 func New() (strm *Stream) {
-	return &Stream{
-		primary:          make(chan Doc, primaryBufferSize),
-		secondary:        make(chan Doc, secondaryBufferSize),
-		writingTimestamp: time.Now(),
-		writingPresent:   make(chan Doc, writingBufferSize),
-		writingPast:      make(chan Doc, writingBufferSize),
+	strm = &Stream{
+		primary:   make(chan *entry, primaryBufferSize),
+		secondary: make(chan *entry, secondaryBufferSize),
+		acks:      make(chan []*ackRange, ackBufferSize),
+		confAcks:  make(chan *ConfAck, confAckBufferSize),
+		unacked:   map[uint64]*entry{},
+		sequence:  uint64(time.Now().UnixMicro()),
+		features:  set.NewSet(),
+		stop:      make(chan struct{}),
+		finished:  make(chan struct{}),
 	}
+
+	strm.initSpool()
+
+	loadConfFile()
+
+	return
 }
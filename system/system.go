@@ -1,6 +1,7 @@
 package system
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -16,8 +17,8 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func getCpu() (cores int, usage float64, err error) {
-	cores, err = cpu.Counts(true)
+func getCpu(ctx context.Context) (cores int, usage float64, err error) {
+	cores, err = cpu.CountsWithContext(ctx, true)
 	if err != nil {
 		err = &errortypes.ParseError{
 			errors.Wrap(err, "system: Failed to get CPU cores"),
@@ -25,7 +26,7 @@ func getCpu() (cores int, usage float64, err error) {
 		return
 	}
 
-	cpuUsages, err := cpu.Percent(0, false)
+	cpuUsages, err := cpu.PercentWithContext(ctx, 0, false)
 	if err != nil {
 		err = &errortypes.ParseError{
 			errors.Wrap(err, "system: Failed to get CPU percent"),
@@ -71,8 +72,8 @@ func getMem() (memTotal int, memUsage float64,
 	return
 }
 
-func Handler(stream *stream.Stream) (err error) {
-	cpuCores, cpuUsage, err := getCpu()
+func Handler(ctx context.Context, stream *stream.Stream) (err error) {
+	cpuCores, cpuUsage, err := getCpu(ctx)
 	if err != nil {
 		return
 	}
@@ -91,7 +92,7 @@ func Handler(stream *stream.Stream) (err error) {
 		return
 	}
 
-	info, err := host.Info()
+	info, err := host.InfoWithContext(ctx)
 	if err != nil {
 		err = &errortypes.ReadError{
 			errors.Wrap(err, "system: Failed to get host info"),
@@ -139,12 +140,25 @@ func Handler(stream *stream.Stream) (err error) {
 	return
 }
 
-func Register() {
-	in := &input.Input{
-		Name:    Type,
-		Rate:    60 * time.Second,
-		Handler: Handler,
-	}
+type Input struct {
+	input.Base
+}
+
+func (i *Input) Name() string {
+	return Type
+}
 
-	input.Register(in)
+func (i *Input) Rate() time.Duration {
+	return 60 * time.Second
+}
+
+func (i *Input) Collect(ctx context.Context) error {
+	return Handler(ctx, i.Stream)
+}
+
+func Register() {
+	stream.RegisterDoc(Type, func() stream.Doc {
+		return &System{}
+	})
+	input.Register(&Input{})
 }
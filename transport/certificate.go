@@ -0,0 +1,209 @@
+package transport
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"sync"
+	"time"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+var (
+	clientCertLock sync.Mutex
+	clientCert     *tls.Certificate
+)
+
+func ClientCertEnabled() bool {
+	return config.Config.Tls.ClientCert
+}
+
+func ClientCertExternal() bool {
+	return config.Config.Tls.ClientCertPath != "" &&
+		config.Config.Tls.ClientKeyPath != ""
+}
+
+func GenerateClientKey() (keyPem, csrPem string, err error) {
+	privKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrap(err, "transport: Failed to generate client key"),
+		}
+		return
+	}
+
+	keyBytes, err := x509.MarshalECPrivateKey(privKey)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "transport: Failed to marshal client key"),
+		}
+		return
+	}
+
+	csrBytes, err := x509.CreateCertificateRequest(
+		rand.Reader,
+		&x509.CertificateRequest{
+			Subject: pkix.Name{
+				CommonName: config.Config.Id,
+			},
+			SignatureAlgorithm: x509.ECDSAWithSHA256,
+		},
+		privKey,
+	)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "transport: Failed to create client csr"),
+		}
+		return
+	}
+
+	keyPem = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "EC PRIVATE KEY",
+		Bytes: keyBytes,
+	}))
+	csrPem = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csrBytes,
+	}))
+
+	return
+}
+
+func parseClientCert(certPem, keyPem []byte) (
+	cert *tls.Certificate, err error) {
+
+	keyPair, err := tls.X509KeyPair(certPem, keyPem)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "transport: Failed to parse client certificate"),
+		}
+		return
+	}
+
+	if keyPair.Leaf == nil {
+		keyPair.Leaf, err = x509.ParseCertificate(keyPair.Certificate[0])
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err,
+					"transport: Failed to parse client certificate"),
+			}
+			return
+		}
+	}
+
+	cert = &keyPair
+
+	return
+}
+
+func loadClientCert() (cert *tls.Certificate, err error) {
+	if ClientCertExternal() {
+		cert, err = LoadClientCertFile(config.Config.Tls.ClientCertPath,
+			config.Config.Tls.ClientKeyPath)
+		return
+	}
+
+	if config.Config.Tls.ClientCertificate == "" ||
+		config.Config.Tls.ClientKey == "" {
+
+		return
+	}
+
+	cert, err = parseClientCert(
+		[]byte(config.Config.Tls.ClientCertificate),
+		[]byte(config.Config.Tls.ClientKey),
+	)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+func LoadClientCertFile(certPath, keyPath string) (
+	cert *tls.Certificate, err error) {
+
+	keyPair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrapf(err,
+				"transport: Failed to load client certificate '%s'",
+				certPath),
+		}
+		return
+	}
+
+	cert = &keyPair
+
+	return
+}
+
+func GetClientCert() (cert *tls.Certificate, err error) {
+	clientCertLock.Lock()
+	defer clientCertLock.Unlock()
+
+	if clientCert != nil && !ClientCertExternal() {
+		cert = clientCert
+		return
+	}
+
+	cert, err = loadClientCert()
+	if err != nil {
+		return
+	}
+
+	clientCert = cert
+
+	return
+}
+
+func SetClientCert(certPem, keyPem string) (err error) {
+	cert, err := parseClientCert([]byte(certPem), []byte(keyPem))
+	if err != nil {
+		return
+	}
+
+	clientCertLock.Lock()
+	clientCert = cert
+	config.Config.Tls.ClientCertificate = certPem
+	config.Config.Tls.ClientKey = keyPem
+	clientCertLock.Unlock()
+
+	return
+}
+
+func ClientCertExpires() (expires time.Time, lifetime time.Duration,
+	err error) {
+
+	cert, err := GetClientCert()
+	if err != nil || cert == nil || cert.Leaf == nil {
+		return
+	}
+
+	expires = cert.Leaf.NotAfter
+	lifetime = cert.Leaf.NotAfter.Sub(cert.Leaf.NotBefore)
+
+	return
+}
+
+func getClientCertificate(info *tls.CertificateRequestInfo) (
+	*tls.Certificate, error) {
+
+	cert, err := GetClientCert()
+	if err != nil {
+		return nil, err
+	}
+
+	if cert == nil {
+		return &tls.Certificate{}, nil
+	}
+
+	return cert, nil
+}
@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+func Proxy(req *http.Request) (proxyUrl *url.URL, err error) {
+	conf := config.Config.Proxy
+
+	if conf.Url == "" {
+		proxyUrl, err = http.ProxyFromEnvironment(req)
+		if err != nil {
+			err = &errortypes.ParseError{
+				errors.Wrap(err, "transport: Failed to get environment proxy"),
+			}
+			return
+		}
+		return
+	}
+
+	proxyUrl, err = url.Parse(conf.Url)
+	if err != nil {
+		err = &errortypes.ParseError{
+			errors.Wrap(err, "transport: Failed to parse proxy url"),
+		}
+		return
+	}
+
+	switch proxyUrl.Scheme {
+	case "http", "socks5":
+		break
+	default:
+		err = &errortypes.ParseError{
+			errors.Newf("transport: Proxy scheme (%s) is invalid",
+				proxyUrl.Scheme),
+		}
+		return
+	}
+
+	if conf.Username != "" {
+		proxyUrl.User = url.UserPassword(conf.Username, conf.Password)
+	}
+
+	return
+}
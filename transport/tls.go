@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/config"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+func GetPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func ServerName(host string) string {
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		return host
+	}
+	return hostname
+}
+
+func getPins(serverName string) (pins []string) {
+	tlsConf := config.Config.Tls
+	if tlsConf.DisablePinning {
+		return
+	}
+
+	if len(tlsConf.Pins) > 0 {
+		pins = tlsConf.Pins
+		return
+	}
+
+	pin := tlsConf.TrustedPins[serverName]
+	if pin != "" {
+		pins = []string{pin}
+	}
+
+	return
+}
+
+func verifyPins(state tls.ConnectionState) (err error) {
+	pins := getPins(state.ServerName)
+	if len(pins) == 0 {
+		return
+	}
+
+	for _, cert := range state.PeerCertificates {
+		pin := GetPin(cert)
+
+		for _, trustedPin := range pins {
+			if subtle.ConstantTimeCompare(
+				[]byte(pin), []byte(trustedPin)) == 1 {
+
+				return
+			}
+		}
+	}
+
+	err = &errortypes.VerificationError{
+		errors.New("transport: Server certificate does not match pin"),
+	}
+	return
+}
+
+func getRootCas() (pool *x509.CertPool, err error) {
+	caPath := config.Config.Tls.CaPath
+	if caPath == "" {
+		return
+	}
+
+	pool, err = x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+		err = nil
+	}
+
+	data, err := ioutil.ReadFile(caPath)
+	if err != nil {
+		err = &errortypes.ReadError{
+			errors.Wrapf(err, "transport: Failed to read CA bundle '%s'",
+				caPath),
+		}
+		return
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		err = &errortypes.ParseError{
+			errors.Newf("transport: Failed to parse CA bundle '%s'",
+				caPath),
+		}
+		return
+	}
+
+	return
+}
+
+func TlsConfig() (conf *tls.Config, err error) {
+	rootCas, err := getRootCas()
+	if err != nil {
+		return
+	}
+
+	conf = &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		MaxVersion:       tls.VersionTLS13,
+		RootCAs:          rootCas,
+		VerifyConnection: verifyPins,
+	}
+
+	if ClientCertEnabled() {
+		conf.GetClientCertificate = getClientCertificate
+	}
+
+	return
+}
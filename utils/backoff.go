@@ -0,0 +1,33 @@
+package utils
+
+import (
+	mathrand "math/rand"
+	"time"
+)
+
+type Backoff struct {
+	Min      time.Duration
+	Max      time.Duration
+	attempts int
+}
+
+func (b *Backoff) Next() (delay time.Duration) {
+	ceiling := b.Min << uint(b.attempts)
+	if ceiling > b.Max || ceiling <= 0 || b.attempts >= 32 {
+		ceiling = b.Max
+	} else {
+		b.attempts += 1
+	}
+
+	if ceiling <= 0 {
+		return
+	}
+
+	delay = time.Duration(mathrand.Int63n(int64(ceiling)))
+
+	return
+}
+
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
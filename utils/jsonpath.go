@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/dropbox/godropbox/errors"
+	"github.com/pritunl/pritunl-endpoint/errortypes"
+)
+
+type JsonPathSegment struct {
+	Key   string
+	Index int
+	IsKey bool
+}
+
+func ParseJsonPath(path string) (segs []*JsonPathSegment, err error) {
+	segs = []*JsonPathSegment{}
+
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end == -1 {
+				end = len(path)
+			}
+
+			if end == 0 {
+				err = &errortypes.ParseError{
+					errors.New("utils: Json path has empty key"),
+				}
+				return
+			}
+
+			segs = append(segs, &JsonPathSegment{
+				Key:   path[:end],
+				IsKey: true,
+			})
+			path = path[end:]
+		case '[':
+			end := strings.IndexByte(path, ']')
+			if end == -1 {
+				err = &errortypes.ParseError{
+					errors.New("utils: Json path missing closing bracket"),
+				}
+				return
+			}
+
+			inner := path[1:end]
+			path = path[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') &&
+				inner[len(inner)-1] == inner[0] {
+
+				segs = append(segs, &JsonPathSegment{
+					Key:   inner[1 : len(inner)-1],
+					IsKey: true,
+				})
+				continue
+			}
+
+			index, e := strconv.Atoi(inner)
+			if e != nil || index < 0 {
+				err = &errortypes.ParseError{
+					errors.Newf("utils: Json path index '%s' invalid", inner),
+				}
+				return
+			}
+
+			segs = append(segs, &JsonPathSegment{
+				Index: index,
+			})
+		default:
+			if len(segs) != 0 {
+				err = &errortypes.ParseError{
+					errors.Newf("utils: Json path '%s' invalid", path),
+				}
+				return
+			}
+			path = "." + path
+		}
+	}
+
+	return
+}
+
+func LookupJsonPath(data interface{}, segs []*JsonPathSegment) (
+	val interface{}, ok bool) {
+
+	val = data
+	for _, seg := range segs {
+		if seg.IsKey {
+			obj, isObj := val.(map[string]interface{})
+			if !isObj {
+				return
+			}
+
+			val, ok = obj[seg.Key]
+			if !ok {
+				return
+			}
+		} else {
+			arr, isArr := val.([]interface{})
+			if !isArr || seg.Index >= len(arr) {
+				ok = false
+				return
+			}
+
+			val = arr[seg.Index]
+		}
+	}
+
+	ok = true
+	return
+}